@@ -1,6 +1,10 @@
 package beats
 
-import "fmt"
+import (
+    "fmt"
+    "sort"
+    "time"
+)
 
 // Bass represents the state of the bass drum: none, drum 1 or drum 2
 type Bass uint8
@@ -72,8 +76,53 @@ const (
     acOn
 )
 
+// Velocity is how hard an instrument is struck, from 1 to MaxVelocity as in
+// MIDI. A velocity of 0 leaves the loudness to the accent of the tick.
+type Velocity uint8
+
+// MaxVelocity is the loudest velocity
+const MaxVelocity = 127
+
+// String gives the velocity as a suffix for a note name, such as "@40", or an
+// empty string when the velocity is not set
+func (v Velocity) String() string {
+    if v == 0 {
+        return ""
+    }
+    return fmt.Sprintf("@%d", v)
+}
+
+// Articulation is how an instrument is struck within its tick: once, as a
+// flam with a soft grace note just ahead of the note, or as a ratchet of 2 to
+// MaxRatchet even hits across the tick
+type Articulation uint8
+
+const (
+    artNone = Articulation(iota)
+    flam
+)
+
+// MaxRatchet is the most hits a ratchet can have in one tick
+const MaxRatchet = 4
+
+// String gives the articulation as a suffix for a note name, "~flam" for a
+// flam or "*3" for a ratchet of 3 hits, or an empty string when the note is
+// struck once
+func (a Articulation) String() string {
+    switch {
+    case a == flam:
+        return "~flam"
+    case a > flam:
+        return fmt.Sprintf("*%d", a)
+    }
+    return ""
+}
+
 // Beat is all the sounds happening at a single tick of the rhythm
-// Tick is what tick of the song pattern this beat is for
+// Tick is what tick of the song pattern this beat is for. Each instrument but
+// the accent has an optional velocity that sets how hard that instrument is
+// struck, such as for a ghost note on the snare, and an optional
+// articulation for a flam or ratchet.
 type Beat struct {
     Tick               int                `json:"tick,omitempty"`
     BassDrum           Bass               `json:"bd,omitempty"`
@@ -86,48 +135,68 @@ type Beat struct {
     HiHat              HiHat              `json:"hh,omitempty"`
     Cymbal             Cymbal             `json:"cy,omitempty"`
     Accent             Accent             `json:"ac,omitempty"`
+
+    BassDrumVelocity           Velocity `json:"bdv,omitempty"`
+    SnareDrumVelocity          Velocity `json:"sdv,omitempty"`
+    LowTomVelocity             Velocity `json:"ltv,omitempty"`
+    MidTomVelocity             Velocity `json:"mtv,omitempty"`
+    HiTomVelocity              Velocity `json:"htv,omitempty"`
+    RimshotCowbellVelocity     Velocity `json:"rcv,omitempty"`
+    HandClapTambourineVelocity Velocity `json:"hcv,omitempty"`
+    HiHatVelocity              Velocity `json:"hhv,omitempty"`
+    CymbalVelocity             Velocity `json:"cyv,omitempty"`
+
+    BassDrumArticulation           Articulation `json:"bda,omitempty"`
+    SnareDrumArticulation          Articulation `json:"sda,omitempty"`
+    LowTomArticulation             Articulation `json:"lta,omitempty"`
+    MidTomArticulation             Articulation `json:"mta,omitempty"`
+    HiTomArticulation              Articulation `json:"hta,omitempty"`
+    RimshotCowbellArticulation     Articulation `json:"rca,omitempty"`
+    HandClapTambourineArticulation Articulation `json:"hca,omitempty"`
+    HiHatArticulation              Articulation `json:"hha,omitempty"`
+    CymbalArticulation             Articulation `json:"cya,omitempty"`
 }
 
 func (b Beat) String() string {
     s := ""
     if b.BassDrum != bdNone {
-        s = fmt.Sprintf("%s+bass_%d", s, b.BassDrum)
+        s = fmt.Sprintf("%s+bass_%d%s%s", s, b.BassDrum, b.BassDrumVelocity, b.BassDrumArticulation)
     }
     if b.SnareDrum != sdNone {
-        s = fmt.Sprintf("%s+snare_%d", s, b.SnareDrum)
+        s = fmt.Sprintf("%s+snare_%d%s%s", s, b.SnareDrum, b.SnareDrumVelocity, b.SnareDrumArticulation)
     }
     if b.LowTom == tOn {
-        s = fmt.Sprintf("%s+low_tom", s)
+        s = fmt.Sprintf("%s+low_tom%s%s", s, b.LowTomVelocity, b.LowTomArticulation)
     }
     if b.MidTom == tOn {
-        s = fmt.Sprintf("%s+mid_tom", s)
+        s = fmt.Sprintf("%s+mid_tom%s%s", s, b.MidTomVelocity, b.MidTomArticulation)
     }
     if b.HiTom == tOn {
-        s = fmt.Sprintf("%s+hi_tom", s)
+        s = fmt.Sprintf("%s+hi_tom%s%s", s, b.HiTomVelocity, b.HiTomArticulation)
     }
     switch b.RimshotCowbell {
     case rimshot:
-        s = fmt.Sprintf("%s+rim", s)
+        s = fmt.Sprintf("%s+rim%s%s", s, b.RimshotCowbellVelocity, b.RimshotCowbellArticulation)
     case cowbell:
-        s = fmt.Sprintf("%s+cow", s)
+        s = fmt.Sprintf("%s+cow%s%s", s, b.RimshotCowbellVelocity, b.RimshotCowbellArticulation)
     }
     switch b.HandClapTambourine {
     case handClap:
-        s = fmt.Sprintf("%s+hcp", s)
+        s = fmt.Sprintf("%s+hcp%s%s", s, b.HandClapTambourineVelocity, b.HandClapTambourineArticulation)
     case tambourine:
-        s = fmt.Sprintf("%s+tamb", s)
+        s = fmt.Sprintf("%s+tamb%s%s", s, b.HandClapTambourineVelocity, b.HandClapTambourineArticulation)
     }
     switch b.HiHat {
     case open:
-        s = fmt.Sprintf("%s+hh_open", s)
+        s = fmt.Sprintf("%s+hh_open%s%s", s, b.HiHatVelocity, b.HiHatArticulation)
     case closed:
-        s = fmt.Sprintf("%s+hh_closed", s)
+        s = fmt.Sprintf("%s+hh_closed%s%s", s, b.HiHatVelocity, b.HiHatArticulation)
     }
     switch b.Cymbal {
     case crash:
-        s = fmt.Sprintf("%s+cy_crash", s)
+        s = fmt.Sprintf("%s+cy_crash%s%s", s, b.CymbalVelocity, b.CymbalArticulation)
     case ride:
-        s = fmt.Sprintf("%s+cy_ride", s)
+        s = fmt.Sprintf("%s+cy_ride%s%s", s, b.CymbalVelocity, b.CymbalArticulation)
     }
     if b.Accent == acOn {
         s = fmt.Sprintf("%s+acc", s)
@@ -140,6 +209,97 @@ func (b Beat) String() string {
     return s
 }
 
+// flamGap is how far a grace note comes ahead of its flammed note. Ticks too
+// short for the gap bring the grace note in half a tick ahead.
+const flamGap = 20 * time.Millisecond
+
+// hit is the instruments of a beat that are struck together at an offset
+// into their tick. Grace notes struck at the end of a tick ahead of the beat
+// that follows are marked ahead.
+type hit struct {
+    offset time.Duration
+    beat   Beat
+    ahead  bool
+}
+
+// hits splits a beat lasting d into the instruments struck at each moment,
+// in order. Every beat with a note has a hit at the start of the tick. Flams
+// add a soft grace note ahead of their note, at a negative offset, and
+// ratchets spread their hits evenly across the tick. The beats of the hits
+// keep the tick and accent but no articulations, and grace notes carry half
+// the velocity of their note.
+func (beat Beat) hits(d time.Duration) []hit {
+    byOffset := map[time.Duration]*Beat{}
+    strike := func(offset time.Duration, f field, value int, velocity int) {
+        b, ok := byOffset[offset]
+        if !ok {
+            b = &Beat{Tick: beat.Tick, Accent: beat.Accent}
+            byOffset[offset] = b
+        }
+        b.set(f, value)
+        b.setVelocity(f, velocity)
+    }
+
+    for _, f := range insts {
+        value := beat.value(f)
+        if f == accentField || value == 0 {
+            continue
+        }
+
+        switch a := beat.articulation(f); {
+        case a == flam:
+            gap := flamGap
+            if gap > d/2 {
+                gap = d / 2
+            }
+            grace := beat.strike(f) / 2
+            if grace < 1 {
+                grace = 1
+            }
+            strike(-gap, f, value, grace)
+            strike(0, f, value, beat.velocity(f))
+        case a > flam:
+            for i := 0; i < int(a); i++ {
+                strike(d*time.Duration(i)/time.Duration(a), f, value, beat.velocity(f))
+            }
+        default:
+            strike(0, f, value, beat.velocity(f))
+        }
+    }
+
+    hits := make([]hit, 0, len(byOffset))
+    for offset, b := range byOffset {
+        hits = append(hits, hit{offset: offset, beat: *b})
+    }
+    sort.Slice(hits, func(i, j int) bool {
+        return hits[i].offset < hits[j].offset
+    })
+    return hits
+}
+
+// strikes gives the hits within a tick of a beat lasting d: those of the beat
+// from the start of the tick on, and the grace notes of the flams of the beat
+// that follows, next, which come at the end of the tick ahead of it
+func (beat Beat) strikes(next Beat, d time.Duration) []hit {
+    var strikes []hit
+    for _, h := range beat.hits(d) {
+        if h.offset >= 0 {
+            strikes = append(strikes, h)
+        }
+    }
+    for _, h := range next.hits(d) {
+        if h.offset < 0 {
+            h.offset += d
+            h.ahead = true
+            strikes = append(strikes, h)
+        }
+    }
+    sort.SliceStable(strikes, func(i, j int) bool {
+        return strikes[i].offset < strikes[j].offset
+    })
+    return strikes
+}
+
 // ByTick implements sort.Interface for []Beat based on the Tick field.
 type ByTick []Beat
 
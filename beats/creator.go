@@ -1,12 +1,14 @@
 package beats
 
 import (
+    "context"
     "encoding/json"
     "fmt"
     "io/ioutil"
     "os"
     "sort"
     "strconv"
+    "strings"
     "time"
 
     "github.com/benbjohnson/clock"
@@ -20,6 +22,14 @@ type state struct {
     cursor     bool
     song       Song
     field      field
+    pattern    int
+    tempo      string
+    history    history
+    player     *Player
+    playhead   int
+    layout     layout
+    selection  *selection
+    clip       *clip
 }
 
 // Create runs the song creation app
@@ -31,13 +41,21 @@ func Create(song Song) {
         cursor:     false,
         song:       song,
         field:      nameField,
+        pattern:    -1,
+    }
+    if len(song.Chain) > 0 {
+        // The song beats are all in patterns so start on the first
+        state.pattern = 0
     }
     clock := clock.New()
     ticker := clock.Ticker(500 * time.Millisecond)
     events := make(chan termbox.Event)
     go func() {
+        var keys keyDecoder
         for {
-            events <- termbox.PollEvent()
+            for _, ev := range keys.decode(termbox.PollEvent()) {
+                events <- ev
+            }
         }
     }()
 
@@ -52,15 +70,29 @@ func Create(song Song) {
     termbox.SetOutputMode(termbox.Output256)
     termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
 
+    state.layout = newLayout(termbox.Size())
     draw(state)
     termbox.Flush()
 
 loop:
     for {
+        // Steps only arrive while the song plays
+        var steps <-chan Step
+        if state.player != nil {
+            steps = state.player.Steps()
+        }
+
         select {
         case <-ticker.C:
             state.cursor = !state.cursor
             update(state)
+        case step, ok := <-steps:
+            if !ok {
+                state.stop()
+            } else if step.Sub == 0 {
+                state.follow(step.Tick)
+            }
+            update(state)
         case ev := <-events:
             switch ev.Type {
             case termbox.EventKey:
@@ -68,13 +100,39 @@ loop:
                     state.song.save()
                 }
                 if ev.Key == termbox.KeyCtrlQ {
+                    state.stop()
                     break loop
                 }
 
-                dispatch(&state, &ev)
+                switch {
+                case ev.Key == termbox.KeyCtrlZ:
+                    state.undo()
+                case ev.Key == termbox.KeyCtrlY:
+                    state.redo()
+                case ev.Key == termbox.KeySpace && !state.input:
+                    if state.player == nil {
+                        state.play()
+                    } else {
+                        state.stop()
+                    }
+                default:
+                    before := state.snapshot()
+                    dispatch(&state, &ev)
+                    state.record(before)
+                }
+
+                state.hear()
                 update(state)
                 termbox.Flush()
-            case termbox.EventResize, termbox.EventMouse:
+            case termbox.EventMouse:
+                before := state.snapshot()
+                click(&state, &ev)
+                state.record(before)
+                state.hear()
+                update(state)
+            case termbox.EventResize:
+                state.layout = newLayout(ev.Width, ev.Height)
+                state.scroll()
                 update(state)
             case termbox.EventError:
                 fmt.Println("Failure during termbox loop")
@@ -85,23 +143,14 @@ loop:
 }
 
 func (song Song) save() {
-    beats := song.Beats
-    sort.Sort(ByTick(beats))
-
-    biggestTick := 0
-    btIndex := 0
-    for i, b := range beats {
-        if b.Tick > biggestTick {
-            empty := Beat{Tick: b.Tick}
-            if empty != b {
-                biggestTick = b.Tick
-                btIndex = i
-            }
-        }
+    song.Beats = trim(song.Beats)
+    patterns := make([]Pattern, len(song.Patterns))
+    for i, p := range song.Patterns {
+        p.Beats = trim(p.Beats)
+        patterns[i] = p
     }
-
-    beats = beats[:btIndex+1]
-    song.Beats = beats
+    song.Patterns = patterns
+    song.Version = CurrentVersion
 
     bytes, err := json.Marshal(song)
     if err != nil {
@@ -114,6 +163,21 @@ func (song Song) save() {
     }
 }
 
+// trim sorts the beats and drops the empty beats after the last one that plays
+func trim(beats []Beat) []Beat {
+    sort.Sort(ByTick(beats))
+
+    n := 0
+    for i, b := range beats {
+        empty := Beat{Tick: b.Tick}
+        if empty != b {
+            n = i + 1
+        }
+    }
+
+    return beats[:n]
+}
+
 func update(state state) {
     termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
     draw(state)
@@ -124,6 +188,7 @@ type field int
 
 const (
     nameField field = iota
+    swingField
     tempoField
     cymbalField
     hiHatField
@@ -151,53 +216,297 @@ var insts = []field{
 }
 
 func (song *Song) update(beatUp *Beat) {
-    for i, beatOld := range song.Beats {
-        if beatUp.Tick == beatOld.Tick {
-            song.Beats[i] = *beatUp
-            return
+    song.Beats = updateBeats(song.Beats, beatUp)
+}
+
+func (song Song) on(tick int) *Beat {
+    return beatOn(song.Beats, tick)
+}
+
+// update changes a beat of the pattern being edited. A pattern with a length
+// grows by whole bars to cover a beat placed past its end.
+func (state *state) update(beatUp *Beat) {
+    length := &state.song.Length
+    if state.pattern < 0 {
+        state.song.update(beatUp)
+    } else {
+        length = &state.song.Patterns[state.pattern].Length
+        state.song.Patterns[state.pattern].update(beatUp)
+    }
+
+    if *length > 0 && beatUp.Tick > *length {
+        bar := state.song.TicksPerBar()
+        *length = (beatUp.Tick + bar - 1) / bar * bar
+    }
+}
+
+// on finds a beat of the pattern being edited
+func (state state) on(tick int) *Beat {
+    if state.pattern < 0 {
+        return state.song.on(tick)
+    }
+    return state.song.Patterns[state.pattern].on(tick)
+}
+
+// lanes gives the lane lengths of the pattern being edited
+func (state state) lanes() map[string]int {
+    if state.pattern < 0 {
+        return state.song.Lanes
+    }
+    return state.song.Patterns[state.pattern].Lanes
+}
+
+// toggleLane loops an instrument of the pattern being edited on the given
+// tick, or back on the pattern when it already loops there. Notes of the
+// instrument past its new loop point are dropped as they would never play.
+func (state *state) toggleLane(f field, tick int) {
+    length := tick
+    if laneLength(state.lanes(), f) == tick {
+        length = 0
+    }
+
+    beats := &state.song.Beats
+    lanes := &state.song.Lanes
+    if state.pattern >= 0 {
+        beats = &state.song.Patterns[state.pattern].Beats
+        lanes = &state.song.Patterns[state.pattern].Lanes
+    }
+    *lanes = setLaneLength(*lanes, f, length)
+    if length > 0 {
+        for i := range *beats {
+            if (*beats)[i].Tick > length {
+                (*beats)[i].set(f, 0)
+                (*beats)[i].setVelocity(f, 0)
+                (*beats)[i].setArticulation(f, artNone)
+            }
         }
     }
-    beats := append(song.Beats, *beatUp)
-    sort.Sort(ByTick(beats))
-    song.Beats = beats
 }
 
-func (song Song) on(tick int) *Beat {
-    for _, beat := range song.Beats {
-        if beat.Tick == tick {
-            return &beat
+// euclid spreads one more or one fewer hit of an instrument evenly over its
+// lane of the pattern being edited, starting from the given tick. The lane
+// is the loop of the instrument, or else the pattern, in whole bars when it
+// has no length.
+func (state *state) euclid(f field, tick int, by int) {
+    beats := &state.song.Beats
+    lanes := &state.song.Lanes
+    length := &state.song.Length
+    if state.pattern >= 0 {
+        beats = &state.song.Patterns[state.pattern].Beats
+        lanes = &state.song.Patterns[state.pattern].Lanes
+        length = &state.song.Patterns[state.pattern].Length
+    }
+
+    steps := laneLength(*lanes, f)
+    if steps == 0 {
+        steps = *length
+    }
+    if steps == 0 {
+        bar := state.song.TicksPerBar()
+        steps = (patternTicks(*beats, 0) + bar - 1) / bar * bar
+        if steps == 0 {
+            steps = bar
+        }
+    }
+
+    hits := 0
+    for tick := 1; tick <= steps; tick++ {
+        if b := beatOn(*beats, tick); b != nil && b.value(f) > 0 {
+            hits++
+        }
+    }
+    hits = (hits + by + steps + 1) % (steps + 1)
+
+    rhythm, err := Euclid(hits, steps, (tick-1)%steps)
+    if err != nil {
+        return
+    }
+    for _, lane := range gridLanes {
+        if lane.field == f {
+            setLane(beats, lanes, length, lane.code, rhythm)
+        }
+    }
+}
+
+// playing gives the pattern being edited as a song of its own, to play on a
+// loop. An empty pattern plays for a bar.
+func (state state) playing() Song {
+    song := state.song.clone()
+    if state.pattern >= 0 {
+        pattern := song.Patterns[state.pattern]
+        song.Beats = pattern.Beats
+        song.Length = pattern.Length
+        song.Lanes = pattern.Lanes
+        // The tempo map counts through the whole chain
+        song.Tempos = nil
+        song.Patterns = nil
+        song.Chain = nil
+    }
+    if song.Ticks() == 0 {
+        song.Length = song.TicksPerBar()
+    }
+    return song
+}
+
+// play starts playing the pattern being edited on a loop
+func (state *state) play() {
+    song := state.playing()
+    if !(song.Tempo > 0) {
+        return
+    }
+    state.player = NewPlayer(song, clock.New(), WithLoop())
+    err := state.player.Start(context.Background())
+    if err != nil {
+        state.player = nil
+    }
+}
+
+// hear passes the song as edited to the player so edits are heard from the
+// next tick on
+func (state *state) hear() {
+    if state.player == nil {
+        return
+    }
+    if song := state.playing(); song.Tempo > 0 {
+        state.player.SetSong(song)
+    }
+}
+
+// stop stops playing
+func (state *state) stop() {
+    if state.player == nil {
+        return
+    }
+    state.player.Stop()
+    state.player = nil
+    state.playhead = 0
+}
+
+// follow moves the playhead to the tick playing, scrolling the grid to keep
+// it in view
+func (state *state) follow(tick int) {
+    state.playhead = tick
+    if tick < state.firstTick || tick >= state.firstTick+state.layout.ticks {
+        state.firstTick = tick
+    }
+}
+
+// switchPattern moves the editor to the next or previous pattern. The song
+// beats can only be edited while the song has no chain.
+func (state *state) switchPattern(by int) {
+    first := -1
+    if len(state.song.Chain) > 0 {
+        first = 0
+    }
+    n := len(state.song.Patterns) - first
+    if n <= 0 {
+        return
+    }
+
+    state.pattern = first + ((state.pattern-first+by)%n+n)%n
+    state.activeTick = 1
+    state.firstTick = 1
+}
+
+// newPattern adds an empty bar long pattern to the end of the chain and moves
+// the editor to it. A song without a chain first has its beats moved into a
+// pattern that starts the chain.
+func (state *state) newPattern() {
+    song := &state.song
+    if len(song.Chain) == 0 {
+        name := patternName(song.Patterns)
+        first := Pattern{Name: name, Length: song.Length, Beats: song.Beats, Lanes: song.Lanes}
+        if first.Ticks() == 0 {
+            first.Length = song.TicksPerBar()
+        }
+        song.Patterns = append(song.Patterns, first)
+        song.Chain = append(song.Chain, Link{Pattern: name})
+        song.Beats = nil
+        song.Length = 0
+        song.Lanes = nil
+    }
+
+    name := patternName(song.Patterns)
+    song.Patterns = append(song.Patterns, Pattern{Name: name, Length: song.TicksPerBar()})
+    song.Chain = append(song.Chain, Link{Pattern: name})
+
+    state.pattern = len(song.Patterns) - 1
+    state.activeTick = 1
+    state.firstTick = 1
+}
+
+// patternName gives the first of A, B, C and so on that no pattern has taken
+func patternName(patterns []Pattern) string {
+    taken := map[string]bool{}
+    for _, p := range patterns {
+        taken[p.Name] = true
+    }
+    for i := 0; ; i++ {
+        name := ""
+        for n := i; ; n = n/26 - 1 {
+            name = string(rune('A'+n%26)) + name
+            if n < 26 {
+                break
+            }
+        }
+        if !taken[name] {
+            return name
         }
     }
-    return nil
 }
 
 func draw(state state) {
+    l := state.layout
+    if l.small() {
+        // Too small to lay the editor out in, so say so in what room there is
+        msg := fmt.Sprintf("Make the window at least %dx%d", minWidth, minHeight)
+        if len(msg) > l.width {
+            msg = msg[:l.width]
+        }
+        printTb(0, 0, termbox.ColorWhite, termbox.ColorBlack, msg)
+        return
+    }
+    r, b := l.right, l.bottom
+
     termbox.SetCell(0, 0, borderTopLeft, termbox.ColorWhite, termbox.ColorBlack)
-    termbox.SetCell(79, 0, borderTopRight, termbox.ColorWhite, termbox.ColorBlack)
-    termbox.SetCell(0, 23, borderBottomLeft, termbox.ColorWhite, termbox.ColorBlack)
-    termbox.SetCell(79, 23, borderBottomRight, termbox.ColorWhite, termbox.ColorBlack)
+    termbox.SetCell(r, 0, borderTopRight, termbox.ColorWhite, termbox.ColorBlack)
+    termbox.SetCell(0, b, borderBottomLeft, termbox.ColorWhite, termbox.ColorBlack)
+    termbox.SetCell(r, b, borderBottomRight, termbox.ColorWhite, termbox.ColorBlack)
 
-    for x := 1; x < 79; x++ {
+    for x := 1; x < r; x++ {
         termbox.SetCell(x, 0, borderVertical, termbox.ColorWhite, termbox.ColorBlack)
         termbox.SetCell(x, 3, borderVertical, termbox.ColorWhite, termbox.ColorBlack)
-        termbox.SetCell(x, 23, borderVertical, termbox.ColorWhite, termbox.ColorBlack)
+        termbox.SetCell(x, b, borderVertical, termbox.ColorWhite, termbox.ColorBlack)
     }
-    for y := 1; y < 23; y++ {
+    for y := 1; y < b; y++ {
         termbox.SetCell(0, y, borderHorizontal, termbox.ColorWhite, termbox.ColorBlack)
-        termbox.SetCell(79, y, borderHorizontal, termbox.ColorWhite, termbox.ColorBlack)
+        termbox.SetCell(r, y, borderHorizontal, termbox.ColorWhite, termbox.ColorBlack)
     }
-    for y := 4; y < 23; y++ {
+    for y := 4; y < gridBottom; y++ {
         termbox.SetCell(12, y, borderHorizontal, termbox.ColorWhite, termbox.ColorBlack)
     }
 
-    for y := 4; y < 23; y = y + 2 {
-        for x := 13; x < 79; x++ {
+    // Rows left below the grid are closed off from it and show the keys
+    if b > gridBottom {
+        for x := 1; x < r; x++ {
+            termbox.SetCell(x, gridBottom, borderVertical, termbox.ColorWhite, termbox.ColorBlack)
+        }
+        termbox.SetCell(0, gridBottom, borderHorizontalLeftBar, termbox.ColorWhite, termbox.ColorBlack)
+        termbox.SetCell(r, gridBottom, borderHorizontalRight, termbox.ColorWhite, termbox.ColorBlack)
+        for i, line := range l.hints(keyHints) {
+            printTb(2, gridBottom+1+i, termbox.ColorBlack|termbox.AttrBold, termbox.ColorBlack, line)
+        }
+    }
+    termbox.SetCell(12, gridBottom, borderTeeUp, termbox.ColorWhite, termbox.ColorBlack)
+
+    for y := 4; y < gridBottom; y = y + 2 {
+        for x := 13; x < r; x++ {
             termbox.SetCell(x, y, borderVertical, termbox.ColorBlack|termbox.AttrBold, termbox.ColorBlack)
         }
     }
 
-    for y := 4; y < 23; y++ {
-        for x := 15; x < 79; x = x + 4 {
+    for y := 4; y < gridBottom; y++ {
+        for x := 15; x < r-1; x = x + 4 {
             var ch rune
             if y%2 == 0 {
                 ch = midDot
@@ -210,15 +519,17 @@ func draw(state state) {
 
             if y%2 == 0 {
                 tick := state.firstTick + ((x - 15) / 4)
-                if b := state.song.on(tick); b != nil {
-                    var field field
-                    for f, s := range fm {
-                        if s.y == y {
-                            field = f
-                            break
-                        }
+                var field field
+                for f, s := range fm {
+                    if s.y == y {
+                        field = f
+                        break
                     }
+                }
 
+                // A lane with a length of its own repeats past its loop point
+                src := laneTick(state.lanes(), field, tick)
+                if b := state.on(src); b != nil {
                     switch field {
                     case cymbalField:
                         switch b.Cymbal {
@@ -315,6 +626,24 @@ func draw(state state) {
                             bg = termbox.ColorWhite
                         }
                     }
+
+                    // Notes with a velocity of their own are shaded by it
+                    if v := b.velocity(field); v > 0 && b.value(field) > 0 {
+                        bg = velocityShade(v)
+                        if v < MaxVelocity/2 {
+                            fg = termbox.ColorWhite
+                        }
+                    }
+
+                    // Repeats of a lane are greyed out
+                    if src != tick && b.value(field) > 0 {
+                        fg = termbox.ColorWhite
+                        bg = repeatShade
+                    }
+                }
+
+                if bg == termbox.ColorBlack && state.isSelected(field, tick) {
+                    bg = selectionShade
                 }
 
                 if fm[state.field].y == y && tick == state.activeTick {
@@ -330,7 +659,49 @@ func draw(state state) {
                 }
             }
 
+            // The tick playing is lit up down the grid
+            if y%2 == 0 && bg == termbox.ColorBlack && state.firstTick+((x-15)/4) == state.playhead {
+                bg = playheadShade
+            }
+
             termbox.SetCell(x, y, ch, fg, bg)
+
+            // Bars are separated down the grid
+            if _, beat, step := state.song.Position(state.firstTick + ((x - 15) / 4)); x > 15 && beat == 1 && step == 1 {
+                sep := borderHorizontal
+                if y%2 == 0 {
+                    sep = borderCross
+                }
+                termbox.SetCell(x-2, y, sep, termbox.ColorWhite, termbox.ColorBlack)
+                if y == 4 {
+                    termbox.SetCell(x-2, 3, borderTeeDown, termbox.ColorWhite, termbox.ColorBlack)
+                    termbox.SetCell(x-2, gridBottom, borderTeeUp, termbox.ColorWhite, termbox.ColorBlack)
+                }
+            }
+
+            // Flams and ratchets are marked beside their note and loop
+            // points of lanes after the last tick of the lane
+            if y%2 == 0 {
+                tick := state.firstTick + ((x - 15) / 4)
+                for f, s := range fm {
+                    if s.y != y {
+                        continue
+                    }
+                    if length := laneLength(state.lanes(), f); length > 0 && tick%length == 0 && x+3 < r {
+                        termbox.SetCell(x+3, y, loopMark, termbox.ColorYellow, termbox.ColorBlack)
+                    }
+                    b := state.on(laneTick(state.lanes(), f, tick))
+                    if b == nil || b.value(f) == 0 {
+                        continue
+                    }
+                    switch a := b.articulation(f); {
+                    case a == flam:
+                        termbox.SetCell(x+1, y, '~', termbox.ColorWhite, termbox.ColorBlack)
+                    case a > flam:
+                        termbox.SetCell(x+1, y, rune('0'+a), termbox.ColorWhite, termbox.ColorBlack)
+                    }
+                }
+            }
         }
     }
 
@@ -348,10 +719,31 @@ func draw(state state) {
                 fg = fg | termbox.AttrBold
             }
         }
-        printfTb(7, 1, fg, bg, "%-60s", state.song.Name)
+        printfTb(7, 1, fg, bg, "%-*.*s", l.nameWidth(), l.nameWidth(), state.song.Name)
     }
 
-    printfTb(68, 1, termbox.ColorWhite, termbox.ColorBlack, "Tempo:")
+    printfTb(l.swingX(), 1, termbox.ColorWhite, termbox.ColorBlack, "Swing:")
+    {
+        fg := termbox.ColorWhite
+        bg := termbox.ColorBlack
+        swing := state.song.Swing
+        if state.field == swingField {
+            fg = termbox.ColorWhite
+            bg = termbox.ColorGreen
+            if state.input {
+                bg = termbox.ColorRed
+            }
+            if state.cursor {
+                fg = fg | termbox.AttrBold
+            }
+        }
+        if swing == 0 && !state.input {
+            swing = MinSwing
+        }
+        printfTb(l.swingX()+7, 1, fg, bg, "%2d%%", swing)
+    }
+
+    printfTb(l.tempoX(), 1, termbox.ColorWhite, termbox.ColorBlack, "Tempo:")
     {
         fg := termbox.ColorWhite
         bg := termbox.ColorBlack
@@ -365,13 +757,36 @@ func draw(state state) {
                 fg = fg | termbox.AttrBold
             }
         }
-        printfTb(75, 1, fg, bg, "%3d", state.song.Tempo)
+        tempo := formatTempo(state.song.Tempo)
+        if state.field == tempoField && state.input {
+            tempo = state.tempo
+        }
+        printfTb(l.tempoX()+7, 1, fg, bg, "%5s", tempo)
     }
 
-    printfTb(1, 2, termbox.ColorWhite, termbox.ColorBlack, "Step")
+    // Step header marks the start of each bar and beat
+    bar, _, _ := state.song.Position(state.firstTick)
+    if b := state.on(laneTick(state.lanes(), state.field, state.activeTick)); state.input && b != nil && b.value(state.field) > 0 && state.field != accentField {
+        printfTb(1, 2, termbox.ColorWhite, termbox.ColorBlack, "Vel %d%s", b.strike(state.field), b.articulation(state.field))
+    } else if state.pattern < 0 {
+        printfTb(1, 2, termbox.ColorWhite, termbox.ColorBlack, "Bar %d", bar)
+    } else {
+        printfTb(1, 2, termbox.ColorWhite, termbox.ColorBlack, "%.4s Bar %d", state.song.Patterns[state.pattern].Name, bar)
+    }
 
-    for x, t := 13, state.firstTick; x < 79-4; x, t = x+4, t+1 {
-        printfTb(x, 2, termbox.ColorWhite, termbox.ColorBlack, fmt.Sprintf("%3d", t))
+    for x, t := 13, state.firstTick; t < state.firstTick+l.ticks; x, t = x+4, t+1 {
+        fg := termbox.ColorBlack | termbox.AttrBold
+        switch _, beat, step := state.song.Position(t); {
+        case beat == 1 && step == 1:
+            fg = termbox.ColorYellow | termbox.AttrBold
+        case step == 1:
+            fg = termbox.ColorWhite
+        }
+        bg := termbox.ColorBlack
+        if t == state.playhead {
+            bg = playheadShade
+        }
+        printfTb(x, 2, fg, bg, fmt.Sprintf("%3d", t))
     }
 
     for _, i := range insts {
@@ -398,9 +813,13 @@ type fs struct {
     down  field
 }
 
+// fm maps the fields of the editor to where they are and the fields the arrow
+// keys move to from them. Swing and tempo move with the width of the terminal
+// so the layout places them.
 var fm = map[field]fs{
-    nameField:      fs{"Name:", 1, 1, nameField, tempoField, nameField, cymbalField},
-    tempoField:     fs{"Tempo:", 68, 1, nameField, tempoField, tempoField, cymbalField},
+    nameField:      fs{"Name:", 1, 1, nameField, swingField, nameField, cymbalField},
+    swingField:     fs{"Swing:", 0, 1, nameField, tempoField, swingField, cymbalField},
+    tempoField:     fs{"Tempo:", 0, 1, swingField, tempoField, tempoField, cymbalField},
     cymbalField:    fs{"CYmbal", 1, 4, cymbalField, cymbalField, nameField, hiHatField},
     hiHatField:     fs{"HiHat", 1, 6, hiHatField, hiHatField, cymbalField, hcpTambField},
     hcpTambField:   fs{"HCP/TAMB", 1, 8, hcpTambField, hcpTambField, hiHatField, rimCowField},
@@ -502,7 +921,133 @@ func (beat Beat) value(field field) int {
     return -1
 }
 
+// velocity gives the velocity set for an instrument, or 0 when it is not set
+func (beat Beat) velocity(field field) int {
+    switch field {
+    case cymbalField:
+        return int(beat.CymbalVelocity)
+    case hiHatField:
+        return int(beat.HiHatVelocity)
+    case hcpTambField:
+        return int(beat.HandClapTambourineVelocity)
+    case rimCowField:
+        return int(beat.RimshotCowbellVelocity)
+    case hiTomField:
+        return int(beat.HiTomVelocity)
+    case midTomField:
+        return int(beat.MidTomVelocity)
+    case lowTomField:
+        return int(beat.LowTomVelocity)
+    case snareDrumField:
+        return int(beat.SnareDrumVelocity)
+    case bassDrumField:
+        return int(beat.BassDrumVelocity)
+    }
+    return 0
+}
+
+// setVelocity sets the velocity of an instrument, kept between 0 for not set
+// and MaxVelocity
+func (beat *Beat) setVelocity(field field, value int) {
+    if value < 0 {
+        value = 0
+    }
+    if value > MaxVelocity {
+        value = MaxVelocity
+    }
+    v := Velocity(value)
+    switch field {
+    case cymbalField:
+        beat.CymbalVelocity = v
+    case hiHatField:
+        beat.HiHatVelocity = v
+    case hcpTambField:
+        beat.HandClapTambourineVelocity = v
+    case rimCowField:
+        beat.RimshotCowbellVelocity = v
+    case hiTomField:
+        beat.HiTomVelocity = v
+    case midTomField:
+        beat.MidTomVelocity = v
+    case lowTomField:
+        beat.LowTomVelocity = v
+    case snareDrumField:
+        beat.SnareDrumVelocity = v
+    case bassDrumField:
+        beat.BassDrumVelocity = v
+    }
+}
+
+// strike gives the velocity an instrument plays at: its own velocity when it
+// is set, and otherwise the normal or accented velocity of the tick
+func (beat Beat) strike(field field) int {
+    if v := beat.velocity(field); v > 0 {
+        return v
+    }
+    if beat.Accent == acOn {
+        return midiAccent
+    }
+    return midiVelocity
+}
+
+// articulation gives the articulation set for an instrument
+func (beat Beat) articulation(field field) Articulation {
+    switch field {
+    case cymbalField:
+        return beat.CymbalArticulation
+    case hiHatField:
+        return beat.HiHatArticulation
+    case hcpTambField:
+        return beat.HandClapTambourineArticulation
+    case rimCowField:
+        return beat.RimshotCowbellArticulation
+    case hiTomField:
+        return beat.HiTomArticulation
+    case midTomField:
+        return beat.MidTomArticulation
+    case lowTomField:
+        return beat.LowTomArticulation
+    case snareDrumField:
+        return beat.SnareDrumArticulation
+    case bassDrumField:
+        return beat.BassDrumArticulation
+    }
+    return artNone
+}
+
+// setArticulation sets the articulation of an instrument. Values past a
+// ratchet of MaxRatchet hits go back to a single hit.
+func (beat *Beat) setArticulation(field field, a Articulation) {
+    if a > MaxRatchet {
+        a = artNone
+    }
+    switch field {
+    case cymbalField:
+        beat.CymbalArticulation = a
+    case hiHatField:
+        beat.HiHatArticulation = a
+    case hcpTambField:
+        beat.HandClapTambourineArticulation = a
+    case rimCowField:
+        beat.RimshotCowbellArticulation = a
+    case hiTomField:
+        beat.HiTomArticulation = a
+    case midTomField:
+        beat.MidTomArticulation = a
+    case lowTomField:
+        beat.LowTomArticulation = a
+    case snareDrumField:
+        beat.SnareDrumArticulation = a
+    case bassDrumField:
+        beat.BassDrumArticulation = a
+    }
+}
+
 func dispatch(state *state, ev *termbox.Event) {
+    if !state.input && state.selecting(ev) {
+        return
+    }
+
     if state.input {
         switch state.field {
         case nameField:
@@ -514,19 +1059,46 @@ func dispatch(state *state, ev *termbox.Event) {
                 state.song.Name = state.song.Name + " "
             }
         case tempoField:
+            // The tempo is typed as text so it can take a decimal point
+            if strings.ContainsRune("0123456789.", ev.Ch) && len(state.tempo) < 5 {
+                tempo := state.tempo + string(ev.Ch)
+                bpm, err := strconv.ParseFloat(tempo, 64)
+                if err == nil {
+                    state.tempo = tempo
+                    state.song.Tempo = bpm
+                }
+            } else if len(state.tempo) > 0 && ev.Key == termbox.KeyBackspace {
+                state.tempo = state.tempo[:len(state.tempo)-1]
+                state.song.Tempo, _ = strconv.ParseFloat(state.tempo, 64)
+            }
+        case swingField:
             if ev.Ch != 0 {
                 i, err := strconv.Atoi(string(ev.Ch))
                 if err == nil {
-                    state.song.Tempo = state.song.Tempo*10 + i
+                    state.song.Swing = state.song.Swing*10 + i
                 }
             } else if ev.Key == termbox.KeyBackspace {
-                state.song.Tempo = int(state.song.Tempo / 10)
+                state.song.Swing = int(state.song.Swing / 10)
             }
         default:
-            beat := state.song.on(state.activeTick)
+            switch ev.Ch {
+            case 'l':
+                state.toggleLane(state.field, state.activeTick)
+                return
+            case 'e':
+                state.euclid(state.field, state.activeTick, 1)
+                return
+            case 'E':
+                state.euclid(state.field, state.activeTick, -1)
+                return
+            }
+
+            // Past its loop point an instrument edits the tick it repeats
+            tick := laneTick(state.lanes(), state.field, state.activeTick)
+            beat := state.on(tick)
             if beat == nil {
                 beat = &Beat{
-                    Tick: state.activeTick,
+                    Tick: tick,
                 }
             }
 
@@ -537,10 +1109,32 @@ func dispatch(state *state, ev *termbox.Event) {
                 case termbox.KeyArrowRight, termbox.KeyArrowDown:
                     beat.set(state.field, beat.value(state.field)+1)
                 }
+            } else if beat.value(state.field) > 0 {
+                switch ev.Ch {
+                case '-':
+                    v := beat.strike(state.field) - velocityStep
+                    if v < 1 {
+                        // Stay audible rather than fall back to the default
+                        v = 1
+                    }
+                    beat.setVelocity(state.field, v)
+                case '+', '=':
+                    beat.setVelocity(state.field, beat.strike(state.field)+velocityStep)
+                case '0':
+                    beat.setVelocity(state.field, 0)
+                case 'a':
+                    // Cycle through a single hit, a flam and the ratchets
+                    beat.setArticulation(state.field, beat.articulation(state.field)+1)
+                }
+            }
+            if beat.value(state.field) == 0 {
+                // A silent instrument keeps no velocity or articulation
+                beat.setVelocity(state.field, 0)
+                beat.setArticulation(state.field, artNone)
             }
 
             termbox.Flush()
-            state.song.update(beat)
+            state.update(beat)
         }
 
         if ev.Key == termbox.KeyEnter {
@@ -550,12 +1144,20 @@ func dispatch(state *state, ev *termbox.Event) {
                     state.song.Tempo = 1
                 }
             }
+            if state.field == swingField {
+                if state.song.Swing < MinSwing {
+                    state.song.Swing = MinSwing
+                }
+                if state.song.Swing > MaxSwing {
+                    state.song.Swing = MaxSwing
+                }
+            }
         }
     } else {
         switch ev.Key {
         case termbox.KeyArrowLeft:
             state.field = fm[state.field].left
-            if state.field != nameField && state.field != tempoField {
+            if state.field != nameField && state.field != swingField && state.field != tempoField {
                 state.activeTick--
                 if state.activeTick < 1 {
                     state.activeTick = 1
@@ -563,7 +1165,7 @@ func dispatch(state *state, ev *termbox.Event) {
             }
         case termbox.KeyArrowRight:
             state.field = fm[state.field].right
-            if state.field != nameField && state.field != tempoField {
+            if state.field != nameField && state.field != swingField && state.field != tempoField {
                 state.activeTick++
             }
         case termbox.KeyArrowUp:
@@ -572,13 +1174,105 @@ func dispatch(state *state, ev *termbox.Event) {
             state.field = fm[state.field].down
         case termbox.KeyEnter:
             state.input = !state.input
+            state.tempo = formatTempo(state.song.Tempo)
+        case termbox.KeyPgdn:
+            state.switchPattern(1)
+        case termbox.KeyPgup:
+            state.switchPattern(-1)
+        case termbox.KeyCtrlN:
+            state.newPattern()
         }
 
-        state.firstTick = state.activeTick - 7
+        state.scroll()
+    }
+}
+
+// playheadShade lights up the tick playing
+const playheadShade = termbox.ColorBlue
+
+// repeatShade is the grey of the notes a lane repeats past its loop point
+const repeatShade = termbox.Attribute(240)
+
+// loopMark marks the loop point of a lane
+const loopMark = '┃'
+
+// velocityStep is how far the velocity keys move a velocity
+const velocityStep = 8
+
+// click handles the mouse. A left click on the grid moves there and cycles
+// the instrument through its values, and a right click silences it. A click
+// on a header field starts typing into it and a click on an instrument name
+// moves to the instrument. The wheel scrolls the grid a beat at a time.
+func click(state *state, ev *termbox.Event) {
+    if ev.Mod&termbox.ModMotion != 0 {
+        // Dragging does not edit
+        return
+    }
+
+    switch ev.Key {
+    case termbox.MouseWheelUp:
+        state.firstTick -= state.song.Steps()
         if state.firstTick < 1 {
             state.firstTick = 1
         }
+        return
+    case termbox.MouseWheelDown:
+        state.firstTick += state.song.Steps()
+        return
+    case termbox.MouseLeft, termbox.MouseRight:
+    default:
+        return
+    }
+
+    // Leave any field being typed into as enter would
+    if state.input {
+        dispatch(state, &termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter})
+    }
+    state.selection = nil
+
+    f, tick, ok := state.layout.hit(ev.MouseX, ev.MouseY, state.firstTick)
+    if !ok {
+        return
+    }
+    state.field = f
+    switch {
+    case f == nameField || f == swingField || f == tempoField:
+        state.input = true
+        state.tempo = formatTempo(state.song.Tempo)
+        return
+    case tick == 0:
+        // The name of an instrument
+        return
     }
+    state.activeTick = tick
+
+    // Past its loop point an instrument edits the tick it repeats
+    tick = laneTick(state.lanes(), f, tick)
+    beat := state.on(tick)
+    if beat == nil {
+        beat = &Beat{Tick: tick}
+    }
+    v := beat.value(f)
+    if ev.Key == termbox.MouseRight && v == 0 {
+        return
+    }
+    beat.set(f, v+1)
+    if ev.Key == termbox.MouseRight || beat.value(f) == v {
+        // Past the last value the instrument goes silent
+        beat.set(f, 0)
+    }
+    if beat.value(f) == 0 {
+        beat.setVelocity(f, 0)
+        beat.setArticulation(f, artNone)
+    }
+    state.update(beat)
+}
+
+// velocityShade gives the shade of grey for a velocity, from dark for the
+// softest to white for the loudest, from the grey ramp of the 256 colors
+func velocityShade(v int) termbox.Attribute {
+    // Colors 232 to 255 are the grey ramp and attributes count colors from 1
+    return termbox.Attribute(233 + v*23/MaxVelocity)
 }
 
 func printTb(x, y int, fg, bg termbox.Attribute, msg string) {
@@ -601,6 +1295,9 @@ const borderVertical rune = 0x2500
 const borderHorizontal rune = 0x2502
 const borderHorizontalLeftBar rune = 0x251C
 const borderHorizontalRight rune = 0x2524
+const borderCross rune = 0x253C
+const borderTeeDown rune = 0x252C
+const borderTeeUp rune = 0x2534
 const boxShadow rune = 0x2588
 const midDot rune = 0x00B7
 const blackSquare rune = 0x25A0
@@ -0,0 +1,107 @@
+package beats
+
+import (
+    "testing"
+
+    "github.com/nsf/termbox-go"
+)
+
+// mouse gives a mouse event on a column and row of the editor
+func mouse(key termbox.Key, x, y int) *termbox.Event {
+    return &termbox.Event{Type: termbox.EventMouse, Key: key, MouseX: x, MouseY: y}
+}
+
+// TestClickCycles verifies that a left click on the grid moves there and
+// cycles the instrument through its values back to silent, and a right click
+// silences it
+func TestClickCycles(t *testing.T) {
+    state := editing(t, groove())
+
+    // The snare drum on tick 3
+    for _, want := range []string{".11.....", ".12.....", ".1......"} {
+        click(state, mouse(termbox.MouseLeft, 21, 18))
+        if got := row(state, snareDrumField); got != want {
+            t.Errorf("Expected snare drum %s but got %s", want, got)
+        }
+    }
+    if state.field != snareDrumField || state.activeTick != 3 {
+        t.Errorf("Expected to move to the snare drum on tick 3 but got field %d tick %d", state.field, state.activeTick)
+    }
+
+    // The bass drum on tick 1, which has a velocity
+    click(state, mouse(termbox.MouseRight, 13, 20))
+    if got := row(state, bassDrumField); got != "..1....." {
+        t.Errorf("Expected bass drum ..1..... but got %s", got)
+    }
+    if b := state.on(1); b.velocity(bassDrumField) != 0 {
+        t.Errorf("Expected the silenced velocity to be 0 but got %d", b.velocity(bassDrumField))
+    }
+
+    // A right click on silence does nothing
+    click(state, mouse(termbox.MouseRight, 17, 20))
+    if got := row(state, bassDrumField); got != "..1....." {
+        t.Errorf("Expected bass drum ..1..... but got %s", got)
+    }
+}
+
+// TestClickScrolled verifies that a click edits the tick shown under it once
+// the grid has scrolled, and that dragging does not edit
+func TestClickScrolled(t *testing.T) {
+    state := editing(t, groove())
+    state.firstTick = 5
+
+    // The third tick shown
+    click(state, mouse(termbox.MouseLeft, 21, 20))
+    if got := row(state, bassDrumField); got != "1.1...1." {
+        t.Errorf("Expected bass drum 1.1...1. but got %s", got)
+    }
+
+    drag := mouse(termbox.MouseLeft, 13, 20)
+    drag.Mod = termbox.ModMotion
+    click(state, drag)
+    if got := row(state, bassDrumField); got != "1.1...1." {
+        t.Errorf("Expected dragging to leave bass drum 1.1...1. but got %s", got)
+    }
+}
+
+// TestClickHeader verifies that clicking a header field starts typing into it,
+// clicking an instrument name moves to it and clicking a field being typed
+// into elsewhere finishes typing as enter does
+func TestClickHeader(t *testing.T) {
+    state := editing(t, groove())
+
+    click(state, mouse(termbox.MouseLeft, 66, 1))
+    if state.field != tempoField || !state.input || state.tempo != "120" {
+        t.Fatalf("Expected to type into the tempo 120 but got field %d input %t tempo %s", state.field, state.input, state.tempo)
+    }
+
+    state.song.Swing = 90
+    state.field = swingField
+    click(state, mouse(termbox.MouseLeft, 3, 12))
+    if state.field != hiTomField || state.input {
+        t.Errorf("Expected to move to the hi tom out of input mode but got field %d input %t", state.field, state.input)
+    }
+    if state.song.Swing != MaxSwing {
+        t.Errorf("Expected finishing typing to keep the swing to %d but got %d", MaxSwing, state.song.Swing)
+    }
+}
+
+// TestClickWheel verifies that the wheel scrolls the grid a beat at a time
+// and not before the first tick
+func TestClickWheel(t *testing.T) {
+    state := editing(t, groove())
+    state.song.StepsPerBeat = 4
+
+    click(state, mouse(termbox.MouseWheelDown, 40, 10))
+    click(state, mouse(termbox.MouseWheelDown, 40, 10))
+    if state.firstTick != 9 {
+        t.Errorf("Expected to scroll to tick 9 but got %d", state.firstTick)
+    }
+
+    click(state, mouse(termbox.MouseWheelUp, 40, 10))
+    click(state, mouse(termbox.MouseWheelUp, 40, 10))
+    click(state, mouse(termbox.MouseWheelUp, 40, 10))
+    if state.firstTick != 1 {
+        t.Errorf("Expected to scroll back to tick 1 but got %d", state.firstTick)
+    }
+}
@@ -0,0 +1,124 @@
+package beats
+
+import (
+    "fmt"
+    "sort"
+)
+
+// Euclid gives the Euclidean rhythm of hits spread as evenly as they go over
+// steps, such as x..x..x. for 3 hits over 8 steps. Rotate moves the hits that
+// many steps later, wrapping around, or earlier when it is negative.
+func Euclid(hits, steps, rotate int) ([]bool, error) {
+    if steps <= 0 {
+        return nil, fmt.Errorf("Euclid steps should be greater than 0")
+    }
+    if hits < 0 || hits > steps {
+        return nil, fmt.Errorf("Euclid hits should be from 0 to %d", steps)
+    }
+
+    // Bjorklund's algorithm: deal the remainder out over the leading groups
+    // until no more than one remainder group is left
+    var front, back [][]bool
+    for i := 0; i < steps; i++ {
+        front = append(front, []bool{i < hits})
+    }
+    front, back = front[:hits], front[hits:]
+    for len(front) > 0 && len(back) > 1 {
+        n := len(back)
+        if len(front) < n {
+            n = len(front)
+        }
+        groups := make([][]bool, n)
+        for i := range groups {
+            groups[i] = append(append([]bool{}, front[i]...), back[i]...)
+        }
+        if len(front) > n {
+            back = front[n:]
+        } else {
+            back = back[n:]
+        }
+        front = groups
+    }
+
+    var flat []bool
+    for _, group := range append(front, back...) {
+        flat = append(flat, group...)
+    }
+    rhythm := make([]bool, steps)
+    for i, hit := range flat {
+        rhythm[((i+rotate)%steps+steps)%steps] = hit
+    }
+    return rhythm, nil
+}
+
+// SetLane writes a rhythm into the lane of the instrument with the given code,
+// such as "bd", merging it with the other instruments of the beats. Every hit
+// plays the first value of the instrument. The instrument loops on the rhythm
+// with a lane length of its own unless the rhythm is as long as the pattern,
+// and a pattern without a length grows to fit the rhythm. A song with a chain
+// has its lanes set on its patterns.
+func (song *Song) SetLane(code string, rhythm []bool) error {
+    if len(song.Chain) > 0 {
+        return fmt.Errorf("Song %s has a chain; set the lane on one of its patterns", song.Name)
+    }
+    return setLane(&song.Beats, &song.Lanes, &song.Length, code, rhythm)
+}
+
+// SetLane writes a rhythm into the lane of the instrument with the given code
+// as Song.SetLane does
+func (pattern *Pattern) SetLane(code string, rhythm []bool) error {
+    return setLane(&pattern.Beats, &pattern.Lanes, &pattern.Length, code, rhythm)
+}
+
+// setLane writes a rhythm into the lane of an instrument of a pattern of beats
+// with the given lanes and length
+func setLane(beats *[]Beat, lanes *map[string]int, length *int, code string, rhythm []bool) error {
+    lane := findLane(code)
+    if lane == nil {
+        return fmt.Errorf("Unknown instrument %s", code)
+    }
+    steps := len(rhythm)
+    if steps == 0 {
+        return fmt.Errorf("Lane rhythm should have at least one step")
+    }
+    if *length > 0 && steps > *length {
+        return fmt.Errorf("Lane rhythm of %d steps should fit in the pattern of %d ticks", steps, *length)
+    }
+
+    // The rhythm replaces the notes of the instrument, and beats left empty
+    // by that are dropped
+    merged := make([]Beat, 0, len(*beats))
+    for _, beat := range *beats {
+        if beat.value(lane.field) > 0 {
+            beat.set(lane.field, 0)
+            beat.setVelocity(lane.field, 0)
+            beat.setArticulation(lane.field, artNone)
+            if beat == (Beat{Tick: beat.Tick}) {
+                continue
+            }
+        }
+        merged = append(merged, beat)
+    }
+    for i, hit := range rhythm {
+        if !hit {
+            continue
+        }
+        beat := beatOn(merged, i+1)
+        if beat == nil {
+            beat = &Beat{Tick: i + 1}
+        }
+        beat.set(lane.field, 1)
+        merged = updateBeats(merged, beat)
+    }
+    sort.Sort(ByTick(merged))
+    *beats = merged
+
+    if *length == 0 && steps > patternTicks(merged, 0) {
+        *length = steps
+    }
+    if steps == patternTicks(merged, *length) {
+        steps = 0
+    }
+    *lanes = setLaneLength(*lanes, lane.field, steps)
+    return nil
+}
@@ -0,0 +1,116 @@
+package beats_test
+
+import (
+    "testing"
+
+    "github.com/cody-s-lee/beats/beats"
+    "github.com/google/go-cmp/cmp"
+)
+
+// rhythm writes a rhythm as x for a hit and . for a rest
+func rhythm(hits []bool) string {
+    s := ""
+    for _, hit := range hits {
+        if hit {
+            s += "x"
+        } else {
+            s += "."
+        }
+    }
+    return s
+}
+
+// TestEuclid verifies the Euclidean rhythms against their well known forms
+func TestEuclid(t *testing.T) {
+    tests := []struct {
+        hits, steps, rotate int
+        want                string
+    }{
+        {0, 4, 0, "...."},
+        {4, 4, 0, "xxxx"},
+        {1, 4, 0, "x..."},
+        {3, 8, 0, "x..x..x."},
+        {5, 8, 0, "x.xx.xx."},
+        {5, 16, 0, "x..x..x..x..x..."},
+        {5, 16, 2, "..x..x..x..x..x."},
+        {3, 8, -1, "..x..x.x"},
+        {7, 12, 0, "x.xx.x.xx.x."},
+    }
+    for _, test := range tests {
+        hits, err := beats.Euclid(test.hits, test.steps, test.rotate)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got := rhythm(hits); got != test.want {
+            t.Errorf("Expected E(%d,%d) rotated %d to be %s but got %s", test.hits, test.steps, test.rotate, test.want, got)
+        }
+    }
+
+    for _, bad := range [][2]int{{1, 0}, {-1, 4}, {5, 4}} {
+        if _, err := beats.Euclid(bad[0], bad[1], 0); err == nil {
+            t.Errorf("Expected E(%d,%d) to fail", bad[0], bad[1])
+        }
+    }
+}
+
+// TestSetLane verifies that a rhythm replaces the notes of its instrument,
+// keeps the other instruments and loops on a lane when it is shorter than
+// the pattern
+func TestSetLane(t *testing.T) {
+    song, err := beats.NewSong("lane", 120, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1, HiHat: 1},
+        beats.Beat{Tick: 2, HiHat: 1},
+        beats.Beat{Tick: 5, SnareDrum: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    hits, err := beats.Euclid(3, 8, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = song.SetLane("bd", hits)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1, HiHat: 1},
+        beats.Beat{Tick: 2, HiHat: 1},
+        beats.Beat{Tick: 4, BassDrum: 1},
+        beats.Beat{Tick: 5, SnareDrum: 1},
+        beats.Beat{Tick: 7, BassDrum: 1},
+    }
+    if diff := cmp.Diff(want, song.Beats); diff != "" {
+        t.Errorf("Beats mismatch (-want +got):\n%s", diff)
+    }
+    if song.Length != 8 || song.Lanes != nil {
+        t.Errorf("Expected a pattern of 8 ticks without lanes but got %d and %v", song.Length, song.Lanes)
+    }
+
+    hits, err = beats.Euclid(1, 3, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = song.SetLane("hh", hits)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff := cmp.Diff(map[string]int{"hh": 3}, song.Lanes); diff != "" {
+        t.Errorf("Lanes mismatch (-want +got):\n%s", diff)
+    }
+    if b := song.BeatAt(4); b.HiHat == 0 {
+        t.Errorf("Expected the hi-hat to loop onto tick 4 but got %s", b)
+    }
+
+    hits, err = beats.Euclid(1, 16, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := song.SetLane("sd", hits); err == nil {
+        t.Errorf("Expected a rhythm longer than the pattern to fail")
+    }
+    if err := song.SetLane("zz", hits[:8]); err == nil {
+        t.Errorf("Expected an unknown instrument to fail")
+    }
+}
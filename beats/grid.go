@@ -0,0 +1,484 @@
+package beats
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// gridLane is one instrument line of a text grid. The letters give the
+// character for each value of the instrument, starting with off, and match
+// the letters drawn by the create UI.
+type gridLane struct {
+    code    string
+    field   field
+    letters string
+}
+
+var gridLanes = []gridLane{
+    gridLane{"CY", cymbalField, ".cr"},
+    gridLane{"HH", hiHatField, ".co"},
+    gridLane{"HC", hcpTambField, ".ht"},
+    gridLane{"RC", rimCowField, ".rc"},
+    gridLane{"HT", hiTomField, ".x"},
+    gridLane{"MT", midTomField, ".x"},
+    gridLane{"LT", lowTomField, ".x"},
+    gridLane{"SD", snareDrumField, ".12"},
+    gridLane{"BD", bassDrumField, ".12"},
+    gridLane{"AC", accentField, ".x"},
+}
+
+// value gives the instrument value for a step character. Besides the letters
+// of the lane, '-' is off and 'x' is the first value of any instrument.
+func (lane gridLane) value(ch rune) (int, bool) {
+    switch ch {
+    case '-':
+        return 0, true
+    case 'x', 'X':
+        return 1, true
+    }
+    i := strings.IndexRune(lane.letters, ch)
+    return i, i >= 0
+}
+
+// gridBlock collects the lanes of the song beats or of one pattern. Widths
+// gives the number of ticks on the line of each lane and lengths the lane
+// lengths set by length lines.
+type gridBlock struct {
+    name    string
+    beats   map[int]*Beat
+    widths  map[string]int
+    lengths map[string]int
+}
+
+func newGridBlock(name string) *gridBlock {
+    return &gridBlock{
+        name:   name,
+        beats:  map[int]*Beat{},
+        widths: map[string]int{},
+    }
+}
+
+// pattern gives the beats of the block in tick order. The length is kept only
+// when the lines of lanes without a length of their own run past the last
+// beat.
+func (block *gridBlock) pattern() Pattern {
+    p := Pattern{Name: block.name, Lanes: block.lengths}
+    for _, beat := range block.beats {
+        p.Beats = append(p.Beats, *beat)
+    }
+    sort.Sort(ByTick(p.Beats))
+
+    ticks := 0
+    for code, width := range block.widths {
+        if _, ok := block.lengths[strings.ToLower(code)]; !ok && width > ticks {
+            ticks = width
+        }
+    }
+    if ticks > patternTicks(p.Beats, 0) {
+        p.Length = ticks
+    }
+    return p
+}
+
+// ParseGrid parses a song written as a text grid. Each instrument is a line
+// of one character per tick led by its code, such as "BD 1...1...1...1...",
+// where '.' or '-' is off, 'x' is the first value of the instrument and the
+// letters are those of the create UI. Spaces and '|' between steps are
+// ignored so bars can be marked. Lines of "key: value" set the version, name,
+// tempo, steps, signature, swing and chain of the song, and "tempos: 17=140
+// linear, 33=90" sets its tempo map. "<code> velocity: 5=40, 13=40" sets the
+// velocity of an instrument on ticks 5 and 13, "<code> articulation: 5=flam,
+// 13=x3" sets a flam on tick 5 and a ratchet of 3 hits on tick 13, "<code>
+// length: 3" loops an instrument every 3 ticks, and "pattern: <name>" starts
+// a pattern whose lanes follow. Blank lines and lines starting with '#' are
+// ignored. The song is validated as by Parse, and a *ValidationError lists
+// every problem found along with the line it is on.
+func ParseGrid(reader io.Reader) (*Song, error) {
+    var v validator
+    song := Song{}
+    top := newGridBlock("")
+    block := top
+    var patterns []*gridBlock
+
+    scanner := bufio.NewScanner(reader)
+    n := 0
+    for scanner.Scan() {
+        n++
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        // Headers are the only lines with a colon
+        if i := strings.Index(line, ":"); i >= 0 {
+            key := strings.ToLower(strings.TrimSpace(line[:i]))
+            value := strings.TrimSpace(line[i+1:])
+            if key == "pattern" {
+                block = newGridBlock(value)
+                patterns = append(patterns, block)
+                continue
+            }
+            if strings.HasSuffix(key, " velocity") {
+                block.addVelocities(&v, n, strings.TrimSuffix(key, " velocity"), value)
+                continue
+            }
+            if strings.HasSuffix(key, " articulation") {
+                block.addArticulations(&v, n, strings.TrimSuffix(key, " articulation"), value)
+                continue
+            }
+            if strings.HasSuffix(key, " length") {
+                block.setLength(&v, n, strings.TrimSuffix(key, " length"), value)
+                continue
+            }
+            err := song.setGridHeader(key, value)
+            if err != nil {
+                v.addLine(CodeGridHeader, key, n, "%v", err)
+            }
+            continue
+        }
+
+        block.addLane(&v, n, line)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+
+    // Grids are read as the current version, which always has a resolution
+    if song.Version == 0 {
+        song.Version = CurrentVersion
+    }
+    if song.StepsPerBeat == 0 {
+        song.StepsPerBeat = 1
+    }
+
+    p := top.pattern()
+    song.Beats = p.Beats
+    song.Length = p.Length
+    song.Lanes = p.Lanes
+    for _, b := range patterns {
+        song.Patterns = append(song.Patterns, b.pattern())
+    }
+
+    v.merge(song.validate())
+    err := v.err()
+    if err != nil {
+        return nil, err
+    }
+    return &song, nil
+}
+
+// setGridHeader sets the song field for a header line of a grid
+func (song *Song) setGridHeader(key, value string) error {
+    var err error
+    switch key {
+    case "version":
+        song.Version, err = strconv.Atoi(value)
+    case "name":
+        song.Name = value
+    case "tempo":
+        song.Tempo, err = strconv.ParseFloat(value, 64)
+    case "tempos":
+        song.Tempos, err = parseTempos(value)
+    case "steps":
+        song.StepsPerBeat, err = strconv.Atoi(value)
+    case "signature":
+        song.Signature = value
+    case "swing":
+        song.Swing, err = strconv.Atoi(strings.TrimSuffix(value, "%"))
+    case "chain":
+        song.Chain, err = parseChain(value)
+    default:
+        return fmt.Errorf("Unknown header %s", key)
+    }
+    if err != nil {
+        return fmt.Errorf("Bad %s %s", key, value)
+    }
+    return nil
+}
+
+// parseChain parses a chain written as pattern names separated by commas,
+// each optionally followed by a repeat count such as "verse x3, fill"
+func parseChain(value string) ([]Link, error) {
+    var chain []Link
+    for _, entry := range strings.Split(value, ",") {
+        fields := strings.Fields(entry)
+        switch {
+        case len(fields) == 1:
+            chain = append(chain, Link{Pattern: fields[0]})
+        case len(fields) == 2 && strings.HasPrefix(fields[1], "x"):
+            repeat, err := strconv.Atoi(fields[1][1:])
+            if err != nil {
+                return nil, err
+            }
+            chain = append(chain, Link{Pattern: fields[0], Repeat: repeat})
+        default:
+            return nil, errors.New("Chain entries should be a pattern name and an optional repeat")
+        }
+    }
+    return chain, nil
+}
+
+// findLane finds the lane for an instrument code
+func findLane(code string) *gridLane {
+    for i := range gridLanes {
+        if gridLanes[i].code == strings.ToUpper(code) {
+            return &gridLanes[i]
+        }
+    }
+    return nil
+}
+
+// addVelocities sets the velocities of an instrument from a velocity line
+// such as "SD velocity: 5=40, 13=40", adding a problem to v for a line n that
+// cannot be used
+func (block *gridBlock) addVelocities(v *validator, n int, code string, value string) {
+    block.addTickValues(v, n, code, value, func(s string) (int, error) {
+        velocity, err := strconv.Atoi(s)
+        if err != nil || velocity < 1 || velocity > MaxVelocity {
+            return 0, fmt.Errorf("Velocity %s should be between 1 and %d", s, MaxVelocity)
+        }
+        return velocity, nil
+    }, (*Beat).setVelocity)
+}
+
+// addArticulations sets the articulations of an instrument from an
+// articulation line such as "HH articulation: 5=flam, 13=x3", adding a problem
+// to v for a line n that cannot be used
+func (block *gridBlock) addArticulations(v *validator, n int, code string, value string) {
+    block.addTickValues(v, n, code, value, func(s string) (int, error) {
+        a, err := parseArticulation(s)
+        return int(a), err
+    }, func(beat *Beat, f field, a int) {
+        beat.setArticulation(f, Articulation(a))
+    })
+}
+
+// addTickValues sets a value of an instrument on each tick of a list such as
+// "5=40, 13=40", using parse to read each value and set to store it
+func (block *gridBlock) addTickValues(v *validator, n int, code string, value string, parse func(string) (int, error), set func(*Beat, field, int)) {
+    l := findLane(code)
+    if l == nil || l.field == accentField {
+        v.addLine(CodeGridInstrument, "", n, "Unknown instrument %s", code)
+        return
+    }
+
+    for _, entry := range strings.Split(value, ",") {
+        parts := strings.Split(strings.TrimSpace(entry), "=")
+        if len(parts) != 2 {
+            v.addLine(CodeGridHeader, "", n, "Values should be written as tick=value")
+            return
+        }
+        tick, err := strconv.Atoi(parts[0])
+        if err != nil || tick < 1 {
+            v.addLine(CodeGridHeader, "", n, "Bad tick %s", parts[0])
+            return
+        }
+        x, err := parse(parts[1])
+        if err != nil {
+            v.addLine(CodeGridHeader, "", n, "%v", err)
+            return
+        }
+
+        beat, ok := block.beats[tick]
+        if !ok {
+            beat = &Beat{Tick: tick}
+            block.beats[tick] = beat
+        }
+        set(beat, l.field, x)
+    }
+}
+
+// parseArticulation parses an articulation written as "flam" or as a ratchet
+// such as "x3"
+func parseArticulation(s string) (Articulation, error) {
+    if strings.EqualFold(s, "flam") {
+        return flam, nil
+    }
+    if strings.HasPrefix(s, "x") {
+        hits, err := strconv.Atoi(s[1:])
+        if err == nil && hits >= 2 && hits <= MaxRatchet {
+            return Articulation(hits), nil
+        }
+    }
+    return artNone, fmt.Errorf("Articulation %s should be flam or x2 to x%d", s, MaxRatchet)
+}
+
+// addLane adds the steps of an instrument line to the block, adding a problem
+// to v for a line n that cannot be used
+func (block *gridBlock) addLane(v *validator, n int, line string) {
+    fields := strings.Fields(line)
+    code := strings.ToUpper(fields[0])
+
+    lane := findLane(code)
+    if lane == nil {
+        v.addLine(CodeGridInstrument, "", n, "Unknown instrument %s", fields[0])
+        return
+    }
+    if _, ok := block.widths[code]; ok {
+        v.addLine(CodeGridInstrument, "", n, "Instrument %s may not repeat", code)
+        return
+    }
+    block.widths[code] = 0
+
+    tick := 0
+    for _, ch := range strings.Join(fields[1:], "") {
+        if ch == '|' {
+            continue
+        }
+        tick++
+
+        value, ok := lane.value(ch)
+        if !ok {
+            v.addLine(CodeGridStep, "", n, "Unknown step %c for instrument %s", ch, code)
+            return
+        }
+        if value == 0 {
+            continue
+        }
+
+        beat, ok := block.beats[tick]
+        if !ok {
+            beat = &Beat{Tick: tick}
+            block.beats[tick] = beat
+        }
+        beat.set(lane.field, value)
+    }
+
+    block.widths[code] = tick
+}
+
+// setLength sets the lane length of an instrument from a length line such as
+// "HH length: 3", adding a problem to v for a line n that cannot be used
+func (block *gridBlock) setLength(v *validator, n int, code string, value string) {
+    l := findLane(code)
+    if l == nil {
+        v.addLine(CodeGridInstrument, "", n, "Unknown instrument %s", code)
+        return
+    }
+    length, err := strconv.Atoi(value)
+    if err != nil || length < 1 {
+        v.addLine(CodeGridHeader, "", n, "Lane length %s should be greater than 0", value)
+        return
+    }
+    if block.lengths == nil {
+        block.lengths = map[string]int{}
+    }
+    block.lengths[strings.ToLower(l.code)] = length
+}
+
+// WriteGrid writes the song as a text grid that ParseGrid reads back. Every
+// instrument gets a line and bars are separated by '|'. The patterns of the
+// song follow its own beats, which are left out when the song has a chain.
+func (song Song) WriteGrid(w io.Writer) error {
+    bw := bufio.NewWriter(w)
+
+    fmt.Fprintf(bw, "version: %d\n", CurrentVersion)
+    fmt.Fprintf(bw, "name: %s\n", song.Name)
+    fmt.Fprintf(bw, "tempo: %s\n", formatTempo(song.Tempo))
+    if len(song.Tempos) > 0 {
+        var changes []string
+        for _, change := range song.Tempos {
+            changes = append(changes, change.String())
+        }
+        fmt.Fprintf(bw, "tempos: %s\n", strings.Join(changes, ", "))
+    }
+    if song.StepsPerBeat != 0 {
+        fmt.Fprintf(bw, "steps: %d\n", song.StepsPerBeat)
+    }
+    if song.Signature != "" {
+        fmt.Fprintf(bw, "signature: %s\n", song.Signature)
+    }
+    if song.Swing != 0 {
+        fmt.Fprintf(bw, "swing: %d\n", song.Swing)
+    }
+    if len(song.Chain) > 0 {
+        var links []string
+        for _, link := range song.Chain {
+            links = append(links, link.String())
+        }
+        fmt.Fprintf(bw, "chain: %s\n", strings.Join(links, ", "))
+    } else {
+        fmt.Fprintln(bw)
+        song.writeLanes(bw, song.Beats, song.Length, song.Lanes)
+    }
+
+    for _, p := range song.Patterns {
+        fmt.Fprintf(bw, "\npattern: %s\n", p.Name)
+        song.writeLanes(bw, p.Beats, p.Length, p.Lanes)
+    }
+
+    return bw.Flush()
+}
+
+// writeLanes writes a line for every instrument of the beats. An instrument
+// with a lane length of its own has a line of that many ticks and a length
+// line after the velocities.
+func (song Song) writeLanes(w io.Writer, beats []Beat, length int, lanes map[string]int) {
+    ticks := patternTicks(beats, length)
+    perBar := song.TicksPerBar()
+    byTick := map[int]Beat{}
+    for _, beat := range beats {
+        byTick[beat.Tick] = beat
+    }
+
+    for _, lane := range gridLanes {
+        width := ticks
+        if l := laneLength(lanes, lane.field); l > 0 {
+            width = l
+        }
+        steps := make([]byte, 0, width+width/perBar)
+        for tick := 1; tick <= width; tick++ {
+            if tick > 1 && (tick-1)%perBar == 0 {
+                steps = append(steps, '|')
+            }
+            ch := lane.letters[0]
+            if beat, ok := byTick[tick]; ok {
+                if v := beat.value(lane.field); v > 0 && v < len(lane.letters) {
+                    ch = lane.letters[v]
+                }
+            }
+            steps = append(steps, ch)
+        }
+        fmt.Fprintf(w, "%s %s\n", lane.code, steps)
+    }
+
+    // Velocities follow the lanes, for the instruments that have any
+    for _, lane := range gridLanes {
+        var velocities []string
+        for _, beat := range beats {
+            if v := beat.velocity(lane.field); v > 0 {
+                velocities = append(velocities, fmt.Sprintf("%d=%d", beat.Tick, v))
+            }
+        }
+        if len(velocities) > 0 {
+            fmt.Fprintf(w, "%s velocity: %s\n", lane.code, strings.Join(velocities, ", "))
+        }
+    }
+
+    // Then articulations, written as in the grid rather than as numbers
+    for _, lane := range gridLanes {
+        var articulations []string
+        for _, beat := range beats {
+            switch a := beat.articulation(lane.field); {
+            case a == flam:
+                articulations = append(articulations, fmt.Sprintf("%d=flam", beat.Tick))
+            case a > flam:
+                articulations = append(articulations, fmt.Sprintf("%d=x%d", beat.Tick, a))
+            }
+        }
+        if len(articulations) > 0 {
+            fmt.Fprintf(w, "%s articulation: %s\n", lane.code, strings.Join(articulations, ", "))
+        }
+    }
+
+    for _, lane := range gridLanes {
+        if l := laneLength(lanes, lane.field); l > 0 {
+            fmt.Fprintf(w, "%s length: %d\n", lane.code, l)
+        }
+    }
+}
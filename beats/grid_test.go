@@ -0,0 +1,153 @@
+package beats_test
+
+import (
+    "bytes"
+    "log"
+    "os"
+    "testing"
+
+    "github.com/cody-s-lee/beats/beats"
+    "github.com/google/go-cmp/cmp"
+)
+
+// TestParseGrid verifies that a grid reads as the same song as its json
+func TestParseGrid(t *testing.T) {
+    reader, err := os.Open("testdata/cowbell.grid")
+    if err != nil {
+        log.Fatal(err)
+    }
+    song, err := beats.ParseGrid(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    reader, err = os.Open("testdata/cowbell.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    expected, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if diff := cmp.Diff(expected, song); diff != "" {
+        t.Errorf("Grid song mismatch (-want +got):\n%s", diff)
+    }
+}
+
+// TestGridRoundTrip verifies that a song written as a grid reads back the same
+func TestGridRoundTrip(t *testing.T) {
+    song, err := beats.Default()
+    if err != nil {
+        t.Fatal(err)
+    }
+    song.Swing = 60
+    song.Length = 32
+
+    var b bytes.Buffer
+    err = song.WriteGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    got, err := beats.ParseGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff := cmp.Diff(song, got); diff != "" {
+        t.Errorf("Round trip mismatch (-want +got):\n%s", diff)
+    }
+}
+
+// TestGridRoundTripChain verifies that the patterns and chain of a song
+// survive a grid
+func TestGridRoundTripChain(t *testing.T) {
+    reader, err := os.Open("testdata/chain.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var b bytes.Buffer
+    err = song.WriteGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    got, err := beats.ParseGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff := cmp.Diff(song, got); diff != "" {
+        t.Errorf("Round trip mismatch (-want +got):\n%s", diff)
+    }
+}
+
+// TestParseGridBadStep verifies that a step must be a value of its instrument
+func TestParseGridBadStep(t *testing.T) {
+    reader, err := os.Open("testdata/bad-step.grid")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    _, err = beats.ParseGrid(reader)
+    if err == nil {
+        t.Fatal("Expected an error")
+    }
+}
+
+// TestGridRoundTripVelocity verifies that instrument velocities survive a grid
+func TestGridRoundTripVelocity(t *testing.T) {
+    reader, err := os.Open("testdata/velocity.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var b bytes.Buffer
+    err = song.WriteGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    got, err := beats.ParseGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff := cmp.Diff(song, got); diff != "" {
+        t.Errorf("Round trip mismatch (-want +got):\n%s", diff)
+    }
+}
+
+// TestGridRoundTripArticulation verifies that flams and ratchets survive a
+// grid
+func TestGridRoundTripArticulation(t *testing.T) {
+    reader, err := os.Open("testdata/trap.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var b bytes.Buffer
+    err = song.WriteGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    got, err := beats.ParseGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff := cmp.Diff(song, got); diff != "" {
+        t.Errorf("Round trip mismatch (-want +got):\n%s", diff)
+    }
+}
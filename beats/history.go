@@ -0,0 +1,122 @@
+package beats
+
+import (
+    "reflect"
+)
+
+// maxHistory is the number of edits the editor can undo
+const maxHistory = 100
+
+// snapshot is the song being edited and where the editor was on it, as kept
+// in the history
+type snapshot struct {
+    song       Song
+    pattern    int
+    field      field
+    activeTick int
+}
+
+// history holds the edits of the editor to undo and the undone edits to redo.
+// A run of typing into one field is a single edit.
+type history struct {
+    undo   []snapshot
+    redo   []snapshot
+    typing bool
+}
+
+// snapshot copies the song being edited and where the editor is on it
+func (state state) snapshot() snapshot {
+    return snapshot{
+        song:       state.song.clone(),
+        pattern:    state.pattern,
+        field:      state.field,
+        activeTick: state.activeTick,
+    }
+}
+
+// restore puts the editor back to a snapshot
+func (state *state) restore(s snapshot) {
+    state.song = s.song.clone()
+    state.pattern = s.pattern
+    state.field = s.field
+    state.activeTick = s.activeTick
+    state.selection = nil
+    state.tempo = formatTempo(state.song.Tempo)
+    state.scroll()
+}
+
+// record adds the snapshot taken before an edit to the history when the
+// edit changed the song. Anything undone can no longer be redone.
+func (state *state) record(before snapshot) {
+    text := state.input && (state.field == nameField || state.field == tempoField || state.field == swingField)
+    if reflect.DeepEqual(before.song, state.song.clone()) {
+        state.history.typing = state.history.typing && text
+        return
+    }
+    if state.history.typing && text {
+        // Still typing into the same field
+        return
+    }
+    state.history.typing = text
+
+    state.history.undo = append(state.history.undo, before)
+    if len(state.history.undo) > maxHistory {
+        state.history.undo = state.history.undo[len(state.history.undo)-maxHistory:]
+    }
+    state.history.redo = nil
+}
+
+// undo takes the editor back before the last edit
+func (state *state) undo() {
+    n := len(state.history.undo)
+    if n == 0 {
+        return
+    }
+    state.history.redo = append(state.history.redo, state.snapshot())
+    state.restore(state.history.undo[n-1])
+    state.history.undo = state.history.undo[:n-1]
+    state.history.typing = false
+    state.input = false
+}
+
+// redo makes the last edit undone again
+func (state *state) redo() {
+    n := len(state.history.redo)
+    if n == 0 {
+        return
+    }
+    state.history.undo = append(state.history.undo, state.snapshot())
+    state.restore(state.history.redo[n-1])
+    state.history.redo = state.history.redo[:n-1]
+    state.history.typing = false
+    state.input = false
+}
+
+// clone copies a song so that edits to one do not show in the other
+func (song Song) clone() Song {
+    song.Tempos = append([]TempoChange(nil), song.Tempos...)
+    song.Beats = append([]Beat(nil), song.Beats...)
+    song.Lanes = cloneLanes(song.Lanes)
+    song.Chain = append([]Link(nil), song.Chain...)
+
+    patterns := song.Patterns
+    song.Patterns = nil
+    for _, pattern := range patterns {
+        pattern.Beats = append([]Beat(nil), pattern.Beats...)
+        pattern.Lanes = cloneLanes(pattern.Lanes)
+        song.Patterns = append(song.Patterns, pattern)
+    }
+    return song
+}
+
+// cloneLanes copies the lane lengths of a pattern
+func cloneLanes(lanes map[string]int) map[string]int {
+    if lanes == nil {
+        return nil
+    }
+    clone := make(map[string]int, len(lanes))
+    for code, length := range lanes {
+        clone[code] = length
+    }
+    return clone
+}
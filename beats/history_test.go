@@ -0,0 +1,162 @@
+package beats
+
+import (
+    "testing"
+
+    "github.com/google/go-cmp/cmp"
+    "github.com/nsf/termbox-go"
+)
+
+// edit sends keys to the editor and keeps its history as the create loop does
+func edit(state *state, evs ...termbox.Event) {
+    for _, ev := range evs {
+        before := state.snapshot()
+        press(state, ev)
+        state.record(before)
+    }
+}
+
+// setTempo changes the tempo as an edit the history keeps
+func setTempo(state *state, bpm float64) {
+    before := state.snapshot()
+    state.song.Tempo = bpm
+    state.record(before)
+}
+
+var enter = termbox.Event{Key: termbox.KeyEnter}
+
+// TestHistoryTyping verifies that a run of typing into one field is undone
+// and redone as a single edit, and typing into it again is another
+func TestHistoryTyping(t *testing.T) {
+    state := editing(t, groove())
+    state.field = nameField
+
+    edit(state, enter, termbox.Event{Ch: 'a'}, termbox.Event{Ch: 'b'}, termbox.Event{Ch: 'c'}, enter)
+    if state.song.Name != "testabc" {
+        t.Fatalf("Expected the name testabc but got %s", state.song.Name)
+    }
+    if len(state.history.undo) != 1 {
+        t.Fatalf("Expected typing to be 1 edit but got %d", len(state.history.undo))
+    }
+
+    edit(state, enter, termbox.Event{Ch: 'd'}, enter)
+    if len(state.history.undo) != 2 {
+        t.Fatalf("Expected typing again to be another edit but got %d edits", len(state.history.undo))
+    }
+
+    state.undo()
+    if state.song.Name != "testabc" {
+        t.Errorf("Expected undo to give the name testabc but got %s", state.song.Name)
+    }
+    state.undo()
+    if state.song.Name != "test" {
+        t.Errorf("Expected undo to give the name test but got %s", state.song.Name)
+    }
+    state.redo()
+    if state.song.Name != "testabc" {
+        t.Errorf("Expected redo to give the name testabc but got %s", state.song.Name)
+    }
+}
+
+// TestHistoryLimit verifies that the history keeps the last maxHistory edits,
+// dropping the oldest
+func TestHistoryLimit(t *testing.T) {
+    state := editing(t, groove())
+    for i := 1; i <= maxHistory+5; i++ {
+        setTempo(state, float64(i))
+    }
+    if len(state.history.undo) != maxHistory {
+        t.Fatalf("Expected %d edits but got %d", maxHistory, len(state.history.undo))
+    }
+
+    for i := 0; i < maxHistory+5; i++ {
+        state.undo()
+    }
+    // The oldest edit kept is the one that set the tempo to 6
+    if state.song.Tempo != 5 {
+        t.Errorf("Expected undo to stop at a tempo of 5 but got %g", state.song.Tempo)
+    }
+    if len(state.history.redo) != maxHistory {
+        t.Errorf("Expected %d edits to redo but got %d", maxHistory, len(state.history.redo))
+    }
+}
+
+// TestHistoryRedoCleared verifies that an edit after an undo leaves nothing
+// to redo
+func TestHistoryRedoCleared(t *testing.T) {
+    state := editing(t, groove())
+    setTempo(state, 90)
+    setTempo(state, 100)
+
+    state.undo()
+    if len(state.history.redo) != 1 {
+        t.Fatalf("Expected 1 edit to redo but got %d", len(state.history.redo))
+    }
+
+    setTempo(state, 110)
+    if len(state.history.redo) != 0 {
+        t.Fatalf("Expected nothing to redo after an edit but got %d", len(state.history.redo))
+    }
+    state.redo()
+    if state.song.Tempo != 110 {
+        t.Errorf("Expected redo to leave the tempo at 110 but got %g", state.song.Tempo)
+    }
+
+    // Moving around the editor is not an edit
+    edit(state, termbox.Event{Key: termbox.KeyArrowRight})
+    if len(state.history.undo) != 2 {
+        t.Errorf("Expected 2 edits but got %d", len(state.history.undo))
+    }
+}
+
+// TestClone verifies that a clone shares no beats, lanes, patterns, tempos or
+// chain with the song it was copied from
+func TestClone(t *testing.T) {
+    song := func() Song {
+        return Song{
+            Name:   "clone",
+            Tempo:  120,
+            Beats:  []Beat{Beat{Tick: 1, BassDrum: 1}},
+            Lanes:  map[string]int{"hh": 3},
+            Tempos: []TempoChange{TempoChange{Tick: 5, BPM: 90}},
+            Chain:  []Link{Link{Pattern: "A", Repeat: 2}},
+            Patterns: []Pattern{Pattern{
+                Name:  "A",
+                Beats: []Beat{Beat{Tick: 1, SnareDrum: 1}},
+                Lanes: map[string]int{"bd": 5},
+            }},
+        }
+    }
+    want := song()
+
+    original := song()
+    clone := original.clone()
+    clone.Beats[0].BassDrum = 2
+    clone.Lanes["hh"] = 4
+    clone.Tempos[0].BPM = 60
+    clone.Chain[0].Repeat = 3
+    clone.Patterns[0].Name = "B"
+    clone.Patterns[0].Beats[0].SnareDrum = 2
+    clone.Patterns[0].Lanes["bd"] = 6
+
+    if diff := cmp.Diff(want, original); diff != "" {
+        t.Errorf("Song changed with its clone (-want +got):\n%s", diff)
+    }
+}
+
+// TestHistorySnapshot verifies that editing the song in place after an undo
+// leaves the edit to redo as it was
+func TestHistorySnapshot(t *testing.T) {
+    state := editing(t, groove())
+    state.song.Lanes = map[string]int{"hh": 3}
+    setTempo(state, 90)
+
+    state.undo()
+    state.song.Beats[0].BassDrum = 2
+    state.song.Lanes["hh"] = 4
+    state.redo()
+
+    if state.song.Beats[0].BassDrum != 1 || state.song.Lanes["hh"] != 3 {
+        t.Errorf("Expected redo to give back the beats and lanes as they were but got %+v and %v", state.song.Beats[0], state.song.Lanes)
+    }
+}
@@ -0,0 +1,125 @@
+package beats
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+)
+
+// Kit is a set of samples to play in place of the synthesized voices. Samples
+// are keyed by instrument and value. Any instrument value without a sample
+// falls back to its synthesized voice.
+type Kit struct {
+    Name    string
+    samples map[note]sample
+}
+
+// note is a single instrument value such as an open hi-hat
+type note struct {
+    field field
+    value int
+}
+
+// sample is decoded audio at its original sample rate
+type sample struct {
+    data []float64
+    rate int
+}
+
+// kitManifest is the on-disk format of a kit. Samples map note names to WAV
+// files relative to the manifest.
+type kitManifest struct {
+    Name    string            `json:"name"`
+    Samples map[string]string `json:"samples"`
+}
+
+// noteNames are the names of each instrument value used in kit manifests. They
+// match the names used when printing a beat.
+var noteNames = map[string]note{
+    "bass_1":    note{bassDrumField, int(bdOne)},
+    "bass_2":    note{bassDrumField, int(bdTwo)},
+    "snare_1":   note{snareDrumField, int(sdOne)},
+    "snare_2":   note{snareDrumField, int(sdTwo)},
+    "low_tom":   note{lowTomField, int(tOn)},
+    "mid_tom":   note{midTomField, int(tOn)},
+    "hi_tom":    note{hiTomField, int(tOn)},
+    "rim":       note{rimCowField, int(rimshot)},
+    "cow":       note{rimCowField, int(cowbell)},
+    "hcp":       note{hcpTambField, int(handClap)},
+    "tamb":      note{hcpTambField, int(tambourine)},
+    "hh_closed": note{hiHatField, int(closed)},
+    "hh_open":   note{hiHatField, int(open)},
+    "cy_crash":  note{cymbalField, int(crash)},
+    "cy_ride":   note{cymbalField, int(ride)},
+}
+
+// LoadKit loads a kit from a manifest file. Sample paths in the manifest are
+// relative to the directory of the manifest.
+func LoadKit(fn string) (*Kit, error) {
+    file, err := os.Open(fn)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    return ParseKit(file, filepath.Dir(fn))
+}
+
+// ParseKit parses a kit manifest from a Reader, loading samples relative to
+// the given directory
+func ParseKit(reader io.Reader, dir string) (*Kit, error) {
+    var manifest kitManifest
+    err := json.NewDecoder(reader).Decode(&manifest)
+    if err != nil {
+        return nil, err
+    }
+
+    kit := Kit{
+        Name:    manifest.Name,
+        samples: map[note]sample{},
+    }
+
+    for name, path := range manifest.Samples {
+        n, ok := noteNames[name]
+        if !ok {
+            return nil, fmt.Errorf("Unknown kit sample %s", name)
+        }
+
+        if !filepath.IsAbs(path) {
+            path = filepath.Join(dir, path)
+        }
+        s, err := loadSample(path)
+        if err != nil {
+            return nil, fmt.Errorf("Could not load sample %s: %v", name, err)
+        }
+        kit.samples[n] = *s
+    }
+
+    return &kit, nil
+}
+
+func loadSample(fn string) (*sample, error) {
+    file, err := os.Open(fn)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    data, rate, err := readWAV(file)
+    if err != nil {
+        return nil, err
+    }
+    return &sample{data, rate}, nil
+}
+
+// voice gives the sound of an instrument value at the given sample rate
+func (kit *Kit) voice(field field, value int, sampleRate int) []float64 {
+    if kit != nil {
+        if s, ok := kit.samples[note{field, value}]; ok {
+            return resample(s.data, s.rate, sampleRate)
+        }
+    }
+    return synth(field, value, sampleRate)
+}
@@ -0,0 +1,209 @@
+package beats_test
+
+import (
+    "bytes"
+    "encoding/binary"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/cody-s-lee/beats/beats"
+)
+
+// TestParseKit verifies a kit loads its samples and the mixer plays them in
+// place of the synthesized voices
+func TestParseKit(t *testing.T) {
+    dir, err := ioutil.TempDir("", "kit")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    // A short block of constant level is easy to find in the mix
+    writeSample(t, filepath.Join(dir, "bd.wav"), 1000, []int16{16384, 16384, 16384, 16384})
+
+    manifest := `{"name": "test kit", "samples": {"bass_1": "bd.wav"}}`
+    kit, err := beats.ParseKit(strings.NewReader(manifest), dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if kit.Name != "test kit" {
+        t.Errorf("Expected kit name test kit but got %s", kit.Name)
+    }
+
+    mixer := beats.NewMixer(kit, 1000)
+    samples := mixer.Mix(beats.Beat{Tick: 1, BassDrum: 1, Accent: 1}, beats.Beat{}, 10*time.Millisecond)
+    if len(samples) != 10 {
+        t.Fatalf("Expected 10 samples but got %d", len(samples))
+    }
+    for i := 0; i < 4; i++ {
+        if samples[i] != 0.5 {
+            t.Errorf("Expected sample %d to be 0.5 but got %f", i, samples[i])
+        }
+    }
+    for i := 4; i < 10; i++ {
+        if samples[i] != 0 {
+            t.Errorf("Expected sample %d to be silent but got %f", i, samples[i])
+        }
+    }
+}
+
+// TestParseKitUnknownNote verifies we fail to load a kit with a sample for a
+// note that does not exist
+func TestParseKitUnknownNote(t *testing.T) {
+    manifest := `{"name": "test kit", "samples": {"kazoo": "kazoo.wav"}}`
+    _, err := beats.ParseKit(strings.NewReader(manifest), ".")
+    if err == nil {
+        t.Fatal("Expected an error")
+    }
+}
+
+// TestParseKitMissingSample verifies we fail to load a kit when a sample file
+// is missing
+func TestParseKitMissingSample(t *testing.T) {
+    manifest := `{"name": "test kit", "samples": {"bass_1": "testdata/missing.wav"}}`
+    _, err := beats.ParseKit(strings.NewReader(manifest), ".")
+    if err == nil {
+        t.Fatal("Expected an error")
+    }
+}
+
+// TestRenderKit verifies that rendering with a kit uses its samples
+func TestRenderKit(t *testing.T) {
+    dir, err := ioutil.TempDir("", "kit")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    writeSample(t, filepath.Join(dir, "bd.wav"), 8000, []int16{10000})
+
+    kit, err := beats.ParseKit(strings.NewReader(`{"samples": {"bass_1": "bd.wav"}}`), dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    song, err := beats.NewSong("kit", 120, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1, Accent: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var buf bytes.Buffer
+    err = song.RenderKit(&buf, 8000, kit)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // One tick at 120 bpm is half a second
+    samples := make([]int16, (buf.Len()-44)/2)
+    if len(samples) != 4000 {
+        t.Fatalf("Expected 4000 samples but got %d", len(samples))
+    }
+    binary.Read(bytes.NewReader(buf.Bytes()[44:]), binary.LittleEndian, samples)
+    if samples[0] != 10000 {
+        t.Errorf("Expected first sample to be 10000 but got %d", samples[0])
+    }
+    if samples[1] != 0 {
+        t.Errorf("Expected second sample to be silent but got %d", samples[1])
+    }
+}
+
+// TestParseKitBadSample verifies we fail to load a kit when the header of a
+// sample file is corrupt, rather than failing when it plays
+func TestParseKitBadSample(t *testing.T) {
+    dir, err := ioutil.TempDir("", "kit")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    tests := []struct {
+        name     string
+        rate     int
+        channels int
+        bits     int
+    }{
+        {"no sample rate", 0, 1, 16},
+        {"no channels", 8000, 0, 16},
+        {"unsupported bits", 8000, 1, 12},
+    }
+    for _, test := range tests {
+        fn := filepath.Join(dir, "bd.wav")
+        writeSampleFormat(t, fn, test.rate, test.channels, test.bits, []int16{10000, 10000})
+
+        _, err := beats.ParseKit(strings.NewReader(`{"samples": {"bass_1": "bd.wav"}}`), dir)
+        if err == nil {
+            t.Errorf("Expected an error loading a sample with %s", test.name)
+        }
+    }
+}
+
+// TestParseKitTruncatedSample verifies we fail to load a kit when a chunk of
+// a sample file claims more bytes than the file holds
+func TestParseKitTruncatedSample(t *testing.T) {
+    dir, err := ioutil.TempDir("", "kit")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    fn := filepath.Join(dir, "bd.wav")
+    writeSample(t, fn, 8000, []int16{10000, 10000})
+    wav, err := ioutil.ReadFile(fn)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // The data chunk header follows the 36 bytes of the RIFF and format chunks
+    huge := []byte{0xF0, 0xFF, 0xFF, 0xFF}
+
+    tests := []struct {
+        name string
+        data []byte
+    }{
+        {"a huge data chunk", append(append(append([]byte{}, wav[:40]...), huge...), wav[44:]...)},
+        {"a huge chunk to skip", append(append(append(append([]byte{}, wav[:36]...), "LIST"...), huge...), wav[36:]...)},
+    }
+    for _, test := range tests {
+        err = ioutil.WriteFile(fn, test.data, 0644)
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        _, err := beats.ParseKit(strings.NewReader(`{"samples": {"bass_1": "bd.wav"}}`), dir)
+        if err == nil {
+            t.Errorf("Expected an error loading a sample with %s", test.name)
+        }
+    }
+}
+
+// writeSample writes a mono 16-bit WAV file
+func writeSample(t *testing.T, fn string, rate int, samples []int16) {
+    writeSampleFormat(t, fn, rate, 1, 16, samples)
+}
+
+// writeSampleFormat writes 16-bit samples to a WAV file whose header gives
+// the rate, channels and bits per sample, whether or not they match
+func writeSampleFormat(t *testing.T, fn string, rate, channels, bits int, samples []int16) {
+    var buf bytes.Buffer
+    buf.WriteString("RIFF")
+    binary.Write(&buf, binary.LittleEndian, uint32(36+len(samples)*2))
+    buf.WriteString("WAVEfmt ")
+    binary.Write(&buf, binary.LittleEndian, []uint32{16})
+    binary.Write(&buf, binary.LittleEndian, []uint16{1, uint16(channels)})
+    binary.Write(&buf, binary.LittleEndian, []uint32{uint32(rate), uint32(rate * channels * bits / 8)})
+    binary.Write(&buf, binary.LittleEndian, []uint16{uint16(channels * bits / 8), uint16(bits)})
+    buf.WriteString("data")
+    binary.Write(&buf, binary.LittleEndian, uint32(len(samples)*2))
+    binary.Write(&buf, binary.LittleEndian, samples)
+
+    err := ioutil.WriteFile(fn, buf.Bytes(), 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+}
@@ -0,0 +1,162 @@
+package beats
+
+import (
+    "strings"
+)
+
+// minWidth and minHeight are the smallest terminal the editor draws in. The
+// instruments take 24 rows and the header needs room for a short name and 8
+// ticks.
+const (
+    minWidth  = 48
+    minHeight = 24
+)
+
+// gridBottom is the row closing the grid under the last instrument
+const gridBottom = minHeight - 1
+
+// keyHints are the keys shown below the grid when there is room for them
+var keyHints = []string{
+    "enter edit",
+    "space play",
+    "shift+arrows select",
+    "l loop",
+    "e/E euclid",
+    "pgup/pgdn pattern",
+    "ctrl-n new pattern",
+    "ctrl-z undo",
+    "ctrl-y redo",
+    "ctrl-s save",
+    "ctrl-q quit",
+}
+
+// layout is where the parts of the editor go in a terminal of a given size.
+// The box fills the terminal and the grid shows as many ticks as fit across
+// it, 16 in 80 columns. Rows below the grid show the keys.
+type layout struct {
+    width  int
+    height int
+    right  int
+    bottom int
+    ticks  int
+}
+
+// newLayout lays the editor out in a terminal of the given size
+func newLayout(width, height int) layout {
+    l := layout{
+        width:  width,
+        height: height,
+        right:  width - 1,
+        bottom: height - 1,
+        ticks:  (width - 14) / 4,
+    }
+    if l.bottom < gridBottom {
+        l.bottom = gridBottom
+    }
+    if l.ticks < 1 {
+        l.ticks = 1
+    }
+    return l
+}
+
+// small reports whether the terminal is too small to draw the editor in
+func (l layout) small() bool {
+    return l.width < minWidth || l.height < minHeight
+}
+
+// nameWidth gives the room for the song name in the header
+func (l layout) nameWidth() int {
+    return l.right - 34
+}
+
+// swingX gives the column of the swing in the header
+func (l layout) swingX() int {
+    return l.right - 26
+}
+
+// tempoX gives the column of the tempo in the header
+func (l layout) tempoX() int {
+    return l.right - 14
+}
+
+// hit gives the field under a column and row of the editor with the grid
+// scrolled to the given first tick. On the grid it also gives the tick, which
+// is 0 for a header field or the name of an instrument. It reports false for
+// anywhere else.
+func (l layout) hit(x, y, firstTick int) (field, int, bool) {
+    if y == 1 {
+        switch {
+        case x >= fm[nameField].x && x < l.swingX()-1:
+            return nameField, 0, true
+        case x >= l.swingX() && x < l.tempoX()-1:
+            return swingField, 0, true
+        case x >= l.tempoX() && x < l.right:
+            return tempoField, 0, true
+        }
+        return nameField, 0, false
+    }
+
+    for _, f := range insts {
+        if fm[f].y != y {
+            continue
+        }
+        switch {
+        case x > 0 && x < 12:
+            return f, 0, true
+        case x >= 13 && x < 13+4*l.ticks:
+            return f, firstTick + (x-13)/4, true
+        }
+    }
+    return nameField, 0, false
+}
+
+// footer gives the rows between the grid and the bottom of the box
+func (l layout) footer() int {
+    if l.bottom <= gridBottom {
+        return 0
+    }
+    return l.bottom - gridBottom - 1
+}
+
+// hints lays out key hints in the rows of the footer, as many to a row as fit
+// inside the box. Hints that do not fit are left out.
+func (l layout) hints(hints []string) []string {
+    var lines []string
+    line := ""
+    for _, hint := range hints {
+        switch {
+        case line == "":
+            line = hint
+        case len(line)+2+len(hint) <= l.width-4:
+            line += "  " + hint
+        default:
+            lines = append(lines, line)
+            line = hint
+        }
+    }
+    if line != "" {
+        lines = append(lines, line)
+    }
+
+    for i := range lines {
+        if len(lines[i]) > l.width-4 {
+            lines[i] = strings.TrimSpace(lines[i][:l.width-4])
+        }
+    }
+    if len(lines) > l.footer() {
+        lines = lines[:l.footer()]
+    }
+    return lines
+}
+
+// scroll keeps the highlighted tick on the grid, centring it when the grid
+// has to move
+func (state *state) scroll() {
+    ticks := state.layout.ticks
+    if state.activeTick < state.firstTick || state.activeTick >= state.firstTick+ticks {
+        state.firstTick = state.activeTick - (ticks/2 - 1)
+    }
+    if state.firstTick < 1 {
+        state.firstTick = 1
+    }
+}
@@ -0,0 +1,146 @@
+package beats
+
+import (
+    "testing"
+
+    "github.com/google/go-cmp/cmp"
+)
+
+// TestNewLayout verifies that the editor fills the terminal, showing as many
+// ticks as fit across it and the keys in any rows below the grid
+func TestNewLayout(t *testing.T) {
+    tests := []struct {
+        width  int
+        height int
+        want   layout
+        footer int
+        small  bool
+    }{
+        {80, 24, layout{width: 80, height: 24, right: 79, bottom: 23, ticks: 16}, 0, false},
+        {270, 40, layout{width: 270, height: 40, right: 269, bottom: 39, ticks: 64}, 15, false},
+        {100, 30, layout{width: 100, height: 30, right: 99, bottom: 29, ticks: 21}, 5, false},
+        {48, 24, layout{width: 48, height: 24, right: 47, bottom: 23, ticks: 8}, 0, false},
+        {47, 24, layout{width: 47, height: 24, right: 46, bottom: 23, ticks: 8}, 0, true},
+        {80, 10, layout{width: 80, height: 10, right: 79, bottom: 23, ticks: 16}, 0, true},
+        {10, 5, layout{width: 10, height: 5, right: 9, bottom: 23, ticks: 1}, 0, true},
+    }
+    for _, test := range tests {
+        l := newLayout(test.width, test.height)
+        if diff := cmp.Diff(test.want, l, cmp.AllowUnexported(layout{})); diff != "" {
+            t.Errorf("%dx%d mismatch (-want +got):\n%s", test.width, test.height, diff)
+        }
+        if l.footer() != test.footer {
+            t.Errorf("Expected %dx%d to have %d rows below the grid but got %d", test.width, test.height, test.footer, l.footer())
+        }
+        if l.small() != test.small {
+            t.Errorf("Expected %dx%d small to be %t", test.width, test.height, test.small)
+        }
+    }
+}
+
+// TestLayoutHeader verifies that the swing and tempo keep to the right of the
+// header and the name takes the room left
+func TestLayoutHeader(t *testing.T) {
+    l := newLayout(80, 24)
+    if l.nameWidth() != 45 || l.swingX() != 53 || l.tempoX() != 65 {
+        t.Errorf("Expected the name 45 wide, swing at 53 and tempo at 65 but got %d, %d and %d", l.nameWidth(), l.swingX(), l.tempoX())
+    }
+
+    l = newLayout(120, 24)
+    if l.nameWidth() != 85 || l.swingX() != 93 || l.tempoX() != 105 {
+        t.Errorf("Expected the name 85 wide, swing at 93 and tempo at 105 but got %d, %d and %d", l.nameWidth(), l.swingX(), l.tempoX())
+    }
+}
+
+// TestLayoutHit verifies that columns and rows map to the fields of the header,
+// the instrument names and the ticks of the grid, four columns to a tick from
+// the first tick shown
+func TestLayoutHit(t *testing.T) {
+    l := newLayout(80, 24)
+    tests := []struct {
+        x, y  int
+        first int
+        field field
+        tick  int
+        ok    bool
+    }{
+        {1, 1, 1, nameField, 0, true},
+        {51, 1, 1, nameField, 0, true},
+        {52, 1, 1, nameField, 0, false},
+        {53, 1, 1, swingField, 0, true},
+        {65, 1, 1, tempoField, 0, true},
+        {79, 1, 1, nameField, 0, false},
+        {1, 4, 1, cymbalField, 0, true},
+        {11, 20, 1, bassDrumField, 0, true},
+        {12, 20, 1, nameField, 0, false},
+        {13, 20, 1, bassDrumField, 1, true},
+        {16, 20, 1, bassDrumField, 1, true},
+        {17, 20, 1, bassDrumField, 2, true},
+        {76, 22, 1, accentField, 16, true},
+        {77, 22, 1, nameField, 0, false},
+        {13, 6, 9, hiHatField, 9, true},
+        {20, 6, 9, hiHatField, 10, true},
+        {13, 5, 1, nameField, 0, false},
+        {13, 3, 1, nameField, 0, false},
+        {13, 23, 1, nameField, 0, false},
+    }
+    for _, test := range tests {
+        f, tick, ok := l.hit(test.x, test.y, test.first)
+        if f != test.field || tick != test.tick || ok != test.ok {
+            t.Errorf("Expected %d,%d from tick %d to hit field %d tick %d %t but got field %d tick %d %t", test.x, test.y, test.first, test.field, test.tick, test.ok, f, tick, ok)
+        }
+    }
+
+    // The header follows the width of the terminal
+    if f, _, _ := newLayout(120, 24).hit(93, 1, 1); f != swingField {
+        t.Errorf("Expected the swing at column 93 in 120 columns but got field %d", f)
+    }
+}
+
+// TestLayoutHints verifies that the keys are laid out as many to a row as fit
+// and left out when the rows run out
+func TestLayoutHints(t *testing.T) {
+    hints := []string{"enter edit", "space play", "ctrl-s save", "ctrl-q quit"}
+
+    l := newLayout(30, 27)
+    want := []string{"enter edit  space play", "ctrl-s save  ctrl-q quit"}
+    if diff := cmp.Diff(want, l.hints(hints)); diff != "" {
+        t.Errorf("Hints mismatch (-want +got):\n%s", diff)
+    }
+
+    l = newLayout(30, 26)
+    want = []string{"enter edit  space play"}
+    if diff := cmp.Diff(want, l.hints(hints)); diff != "" {
+        t.Errorf("Hints mismatch (-want +got):\n%s", diff)
+    }
+
+    l = newLayout(80, 24)
+    if lines := l.hints(hints); len(lines) != 0 {
+        t.Errorf("Expected no room for hints but got %v", lines)
+    }
+}
+
+// TestScroll verifies that the grid only moves once the highlighted tick
+// would leave it, and then centres the tick
+func TestScroll(t *testing.T) {
+    tests := []struct {
+        first  int
+        active int
+        want   int
+    }{
+        {1, 1, 1},
+        {1, 16, 1},
+        {1, 17, 10},
+        {10, 12, 10},
+        {10, 9, 2},
+        {10, 3, 1},
+        {5, 1, 1},
+    }
+    for _, test := range tests {
+        state := state{firstTick: test.first, activeTick: test.active, layout: newLayout(80, 24)}
+        state.scroll()
+        if state.firstTick != test.want {
+            t.Errorf("Expected tick %d from %d to scroll to %d but got %d", test.active, test.first, test.want, state.firstTick)
+        }
+    }
+}
@@ -0,0 +1,179 @@
+package beats
+
+import (
+    "fmt"
+    "math"
+    "math/rand"
+)
+
+// Markov is a model of grooves learned from songs. It counts how often each
+// whole beat follows another at each step of the bar, and generates new
+// songs by walking those counts.
+type Markov struct {
+    // next counts the beats that follow a beat on a step of the bar, and
+    // steps the beats on a step whatever came before, for beats never
+    // followed on that step
+    next  map[markovKey]*tally
+    steps map[int]*tally
+
+    songs  int
+    tempo  float64
+    meters []meter
+}
+
+// meter is the steps of a beat and the time signature of a song
+type meter struct {
+    steps     int
+    signature string
+}
+
+// markovKey is a beat and the step of the bar of the beat that follows it
+type markovKey struct {
+    step int
+    beat Beat
+}
+
+// tally counts beats, keeping the order they were first seen in so walking
+// them with the same seed gives the same beats
+type tally struct {
+    beats  []Beat
+    counts map[Beat]int
+    total  int
+}
+
+// NewMarkov creates a Markov model that has not learned any songs
+func NewMarkov() *Markov {
+    return &Markov{
+        next:  map[markovKey]*tally{},
+        steps: map[int]*tally{},
+    }
+}
+
+// Train teaches the model the beats of a song, played once through with its
+// chain and lanes. The last tick leads back to the first as the song loops.
+// Songs without ticks are left out.
+func (markov *Markov) Train(song Song) {
+    song = song.Arrange()
+    ticks := song.Ticks()
+    if ticks == 0 {
+        return
+    }
+
+    bar := song.TicksPerBar()
+    for n := 1; n <= ticks; n++ {
+        beat := markovState(song.BeatAt(n))
+        next := markovState(song.BeatAt(n%ticks + 1))
+        step := n % ticks % bar
+
+        key := markovKey{step: step, beat: beat}
+        if markov.next[key] == nil {
+            markov.next[key] = &tally{}
+        }
+        markov.next[key].add(next)
+        if markov.steps[step] == nil {
+            markov.steps[step] = &tally{}
+        }
+        markov.steps[step].add(next)
+    }
+
+    beats, unit := song.Meter()
+    markov.meters = append(markov.meters, meter{steps: song.Steps(), signature: fmt.Sprintf("%d/%d", beats, unit)})
+
+    markov.tempo = (markov.tempo*float64(markov.songs) + song.Tempo) / float64(markov.songs+1)
+    markov.songs++
+}
+
+// Generate creates a new song of the given number of ticks from what the
+// model has learned, drawing from r so the same seed gives the same song. It
+// plays at the average tempo of the songs learned, in their most common
+// meter. The song is checked by NewSong.
+func (markov *Markov) Generate(name string, ticks int, r *rand.Rand) (*Song, error) {
+    if markov.songs == 0 {
+        return nil, fmt.Errorf("Markov model should learn at least one song")
+    }
+    if ticks <= 0 {
+        return nil, fmt.Errorf("Song length should be greater than 0")
+    }
+
+    // The song takes the meter most of the songs learned were in
+    meter := markov.meter()
+    bar := Song{StepsPerBeat: meter.steps, Signature: meter.signature}.TicksPerBar()
+
+    var beats []Beat
+    beat := markov.steps[0].draw(r)
+    for n := 1; n <= ticks; n++ {
+        if beat != (Beat{}) {
+            beat.Tick = n
+            beats = append(beats, beat)
+            beat.Tick = 0
+        }
+
+        step := n % bar
+        if t := markov.next[markovKey{step: step, beat: beat}]; t != nil {
+            beat = t.draw(r)
+        } else if t := markov.steps[step]; t != nil {
+            beat = t.draw(r)
+        } else {
+            // The songs learned were in other meters and never reached this
+            // step
+            beat = Beat{}
+        }
+    }
+
+    // The average tempo is kept to hundredths as a MIDI import is
+    song, err := NewSong(name, math.Round(markov.tempo*100)/100, beats)
+    if err != nil {
+        return nil, err
+    }
+    song.StepsPerBeat = meter.steps
+    song.Signature = meter.signature
+    song.Length = ticks
+    return song, nil
+}
+
+// meter gives the meter most of the songs learned were in, the first to get
+// there of any tie
+func (markov *Markov) meter() meter {
+    counts := map[meter]int{}
+    most := markov.meters[0]
+    for _, m := range markov.meters {
+        counts[m]++
+        if counts[m] > counts[most] {
+            most = m
+        }
+    }
+    return most
+}
+
+// markovState gives a beat without its tick, as it is learned
+func markovState(beat Beat) Beat {
+    beat.Tick = 0
+    return beat
+}
+
+// add counts a beat
+func (t *tally) add(beat Beat) {
+    if t.counts == nil {
+        t.counts = map[Beat]int{}
+    }
+    if t.counts[beat] == 0 {
+        t.beats = append(t.beats, beat)
+    }
+    t.counts[beat]++
+    t.total++
+}
+
+// draw picks a beat at random, each as likely as it was counted
+func (t *tally) draw(r *rand.Rand) Beat {
+    if t == nil || t.total == 0 {
+        return Beat{}
+    }
+    i := r.Intn(t.total)
+    for _, beat := range t.beats {
+        i -= t.counts[beat]
+        if i < 0 {
+            return beat
+        }
+    }
+    return Beat{}
+}
@@ -0,0 +1,99 @@
+package beats_test
+
+import (
+    "bytes"
+    "log"
+    "math/rand"
+    "os"
+    "testing"
+
+    "github.com/cody-s-lee/beats/beats"
+    "github.com/google/go-cmp/cmp"
+)
+
+// corpus gives a Markov model trained on a few of the test songs
+func corpus(t *testing.T) *beats.Markov {
+    markov := beats.NewMarkov()
+    for _, fn := range []string{"testdata/cowbell.json", "testdata/trap.json", "testdata/polymeter.json"} {
+        reader, err := os.Open(fn)
+        if err != nil {
+            log.Fatal(err)
+        }
+        song, err := beats.Parse(reader)
+        if err != nil {
+            t.Fatal(err)
+        }
+        markov.Train(*song)
+    }
+    return markov
+}
+
+// TestMarkovSeed verifies that the same seed generates the same song and that
+// the song is valid
+func TestMarkovSeed(t *testing.T) {
+    markov := corpus(t)
+
+    song, err := markov.Generate("practice", 64, rand.New(rand.NewSource(7)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    again, err := markov.Generate("practice", 64, rand.New(rand.NewSource(7)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff := cmp.Diff(song, again); diff != "" {
+        t.Errorf("Same seed mismatch (-want +got):\n%s", diff)
+    }
+    if ticks := song.Ticks(); ticks != 64 {
+        t.Errorf("Expected 64 ticks but got %d", ticks)
+    }
+
+    var b bytes.Buffer
+    err = song.WriteJSON(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = beats.ParseStrict(&b)
+    if err != nil {
+        t.Errorf("Expected a valid song but got %v", err)
+    }
+}
+
+// TestMarkovStyle verifies that a model of one song only plays the beats of
+// that song, each on a step of the bar it was learned on
+func TestMarkovStyle(t *testing.T) {
+    reader, err := os.Open("testdata/cowbell.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    markov := beats.NewMarkov()
+    markov.Train(*song)
+
+    learned := map[beats.Beat]bool{}
+    for n := 1; n <= song.Ticks(); n++ {
+        beat := song.BeatAt(n)
+        beat.Tick = (n-1)%song.TicksPerBar() + 1
+        learned[beat] = true
+    }
+
+    for seed := int64(1); seed <= 5; seed++ {
+        generated, err := markov.Generate("cowbell", 32, rand.New(rand.NewSource(seed)))
+        if err != nil {
+            t.Fatal(err)
+        }
+        for _, beat := range generated.Beats {
+            beat.Tick = (beat.Tick-1)%generated.TicksPerBar() + 1
+            if !learned[beat] {
+                t.Errorf("Seed %d played %s on step %d, which was never learned there", seed, beat, beat.Tick)
+            }
+        }
+    }
+
+    if _, err := beats.NewMarkov().Generate("none", 16, rand.New(rand.NewSource(1))); err == nil {
+        t.Errorf("Expected a model without songs to fail")
+    }
+}
@@ -0,0 +1,509 @@
+package beats
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "math"
+    "sort"
+)
+
+// MIDI files are written with a fixed resolution of MIDI ticks per quarter
+// note. Each beat of the song is a quarter note.
+const (
+    midiDivision    = 96
+    midiDrumChannel = 9
+    midiVelocity    = 96
+    midiAccent      = 127
+)
+
+// gmNotes maps each instrument value to its General MIDI drum note
+var gmNotes = map[note]uint8{
+    note{bassDrumField, int(bdOne)}:     36,
+    note{bassDrumField, int(bdTwo)}:     35,
+    note{snareDrumField, int(sdOne)}:    38,
+    note{snareDrumField, int(sdTwo)}:    40,
+    note{lowTomField, int(tOn)}:         45,
+    note{midTomField, int(tOn)}:         47,
+    note{hiTomField, int(tOn)}:          50,
+    note{rimCowField, int(rimshot)}:     37,
+    note{rimCowField, int(cowbell)}:     56,
+    note{hcpTambField, int(handClap)}:   39,
+    note{hcpTambField, int(tambourine)}: 54,
+    note{hiHatField, int(closed)}:       42,
+    note{hiHatField, int(open)}:         46,
+    note{cymbalField, int(crash)}:       49,
+    note{cymbalField, int(ride)}:        51,
+}
+
+// midiEvent is a single event at an absolute time in MIDI ticks
+type midiEvent struct {
+    time int
+    data []byte
+}
+
+// WriteSMF writes the song as a Type 0 Standard MIDI File. Notes are written
+// on the General MIDI drum channel and the accent raises their velocity. The
+// tempo and time signature of the song are written as meta events, and swing
+// delays the notes on even ticks. Flams and ratchets are written as the notes
+// they strike within their tick. A song with a chain is written as the whole
+// chain.
+func (song Song) WriteSMF(w io.Writer) error {
+    song = song.Arrange()
+
+    // Time signature note value as a power of 2
+    perBar, unit := song.Meter()
+    power := byte(0)
+    for u := unit; u > 1; u >>= 1 {
+        power++
+    }
+
+    events := []midiEvent{
+        midiEvent{0, metaEvent(0x03, []byte(song.Name))},
+        midiEvent{0, metaEvent(0x58, []byte{byte(perBar), power, 24, 8})},
+    }
+
+    // A tempo event starts the track and follows every tick the tempo
+    // changes on, so a ramp is written a tick at a time
+    steps := song.Steps()
+    tempo := 0.0
+    for tick := 1; tick <= song.Ticks() || tick == 1; tick++ {
+        bpm := song.TempoAt(tick)
+        if bpm == tempo {
+            continue
+        }
+        tempo = bpm
+        // Microseconds per quarter note
+        mpq := int(math.Round(60000000 / bpm))
+        events = append(events, midiEvent{(tick - 1) * midiDivision / steps, metaEvent(0x51, []byte{byte(mpq >> 16), byte(mpq >> 8), byte(mpq)})})
+    }
+
+    // Start of a tick in MIDI ticks, including swing
+    swing := 0
+    if song.Swing > MinSwing {
+        swing = song.Swing - MinSwing
+    }
+    at := func(tick int) int {
+        t := (tick - 1) * midiDivision / steps
+        if tick%2 == 0 {
+            t += 2 * swing * midiDivision / steps / 100
+        }
+        return t
+    }
+
+    for tick := 1; tick <= song.Ticks(); tick++ {
+        beat := song.BeatAt(tick)
+        start := at(beat.Tick)
+        step := at(beat.Tick+1) - start
+
+        // Flams and ratchets strike within the tick, scaled from real time,
+        // and the grace notes of flams on the next tick at its end
+        var next Beat
+        if tick < song.Ticks() {
+            next = song.BeatAt(tick + 1)
+        }
+        d := song.StepDuration(beat.Tick)
+        hits := beat.strikes(next, d)
+        for i, h := range hits {
+            offset := int(int64(step) * int64(h.offset) / int64(d))
+            next := step
+            if i+1 < len(hits) {
+                next = int(int64(step) * int64(hits[i+1].offset) / int64(d))
+            }
+            length := (next - offset) / 2
+            if length < 1 {
+                length = 1
+            }
+
+            for _, f := range insts {
+                key, ok := gmNotes[note{f, h.beat.value(f)}]
+                if !ok {
+                    continue
+                }
+                velocity := byte(h.beat.strike(f))
+                events = append(events,
+                    midiEvent{start + offset, []byte{0x90 | midiDrumChannel, key, velocity}},
+                    midiEvent{start + offset + length, []byte{0x80 | midiDrumChannel, key, 0}},
+                )
+            }
+        }
+    }
+
+    // Note offs sort before note ons at the same time so repeated notes on
+    // neighbouring ticks never overlap
+    sort.SliceStable(events, func(i, j int) bool {
+        if events[i].time != events[j].time {
+            return events[i].time < events[j].time
+        }
+        return events[i].data[0]&0xF0 == 0x80 && events[j].data[0]&0xF0 == 0x90
+    })
+
+    // The track runs for the whole pattern length
+    end := song.Ticks() * midiDivision / steps
+    events = append(events, midiEvent{end, metaEvent(0x2F, nil)})
+
+    var track []byte
+    last := 0
+    for _, e := range events {
+        track = appendVarLen(track, e.time-last)
+        track = append(track, e.data...)
+        last = e.time
+    }
+
+    bw := bufio.NewWriter(w)
+    bw.WriteString("MThd")
+    binary.Write(bw, binary.BigEndian, []uint32{6})
+    binary.Write(bw, binary.BigEndian, []uint16{0, 1, midiDivision})
+    bw.WriteString("MTrk")
+    binary.Write(bw, binary.BigEndian, uint32(len(track)))
+    bw.Write(track)
+    return bw.Flush()
+}
+
+// metaEvent builds a meta event of the given type
+func metaEvent(kind byte, data []byte) []byte {
+    return append(appendVarLen([]byte{0xFF, kind}, len(data)), data...)
+}
+
+// appendVarLen appends a MIDI variable length quantity
+func appendVarLen(b []byte, v int) []byte {
+    var buf [4]byte
+    i := len(buf) - 1
+    buf[i] = byte(v & 0x7F)
+    for v >>= 7; v > 0; v >>= 7 {
+        i--
+        buf[i] = byte(v&0x7F) | 0x80
+    }
+    return append(b, buf[i:]...)
+}
+
+// gmImport maps General MIDI drum notes to instrument values when importing.
+// Alongside the notes written on export, similar drums are folded into the
+// nearest instrument the TR-707 has.
+var gmImport = map[uint8]note{
+    41: note{lowTomField, int(tOn)},
+    43: note{lowTomField, int(tOn)},
+    44: note{hiHatField, int(closed)},
+    48: note{midTomField, int(tOn)},
+    52: note{cymbalField, int(crash)},
+    53: note{cymbalField, int(ride)},
+    55: note{cymbalField, int(crash)},
+    57: note{cymbalField, int(crash)},
+    59: note{cymbalField, int(ride)},
+}
+
+func init() {
+    for n, key := range gmNotes {
+        gmImport[key] = n
+    }
+}
+
+// Defaults for importing MIDI files
+const (
+    // DefaultAccentVelocity is the velocity above which imported notes set the
+    // accent on their tick
+    DefaultAccentVelocity = 100
+    // DefaultImportSteps quantizes imported notes to sixteenth notes
+    DefaultImportSteps = 4
+)
+
+// ImportOptions control how a MIDI file is imported
+type ImportOptions struct {
+    // Name is the song name used when the file does not name its track
+    Name string
+    // AccentVelocity is the velocity above which a note accents its tick
+    AccentVelocity int
+    // StepsPerBeat is the number of ticks each quarter note is quantized to
+    StepsPerBeat int
+}
+
+// Unmapped is a drum note in an imported MIDI file that could not be placed in
+// the song
+type Unmapped struct {
+    Tick   int
+    Key    int
+    Reason string
+}
+
+func (u Unmapped) String() string {
+    return fmt.Sprintf("note %d on tick %d: %s", u.Key, u.Tick, u.Reason)
+}
+
+// ReadSMF reads a Type 0 or Type 1 Standard MIDI File into a song. Notes on
+// the General MIDI drum channel (10) are quantized to the nearest tick of the
+// step resolution in the options. Notes on other channels are ignored. Drum notes
+// that cannot be placed in the song are returned rather than dropped. When the
+// file runs on past its last note the song length keeps the extra ticks. The
+// first tempo of the file is the song tempo and later tempos make its tempo
+// map.
+func ReadSMF(reader io.Reader, opts ImportOptions) (*Song, []Unmapped, error) {
+    r := bufio.NewReader(reader)
+
+    var header struct {
+        ID       [4]byte
+        Size     uint32
+        Format   uint16
+        Tracks   uint16
+        Division int16
+    }
+    err := binary.Read(r, binary.BigEndian, &header)
+    if err != nil {
+        return nil, nil, err
+    }
+    if string(header.ID[:]) != "MThd" {
+        return nil, nil, errors.New("Not a Standard MIDI File")
+    }
+    if header.Format > 1 {
+        return nil, nil, fmt.Errorf("Unsupported MIDI file format %d", header.Format)
+    }
+    if header.Division <= 0 {
+        return nil, nil, errors.New("MIDI files with SMPTE timing are not supported")
+    }
+    // Skip any extra header bytes
+    _, err = r.Discard(int(header.Size) - 6)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    var events []midiEvent
+    for i := 0; i < int(header.Tracks); {
+        var chunk struct {
+            ID   [4]byte
+            Size uint32
+        }
+        err = binary.Read(r, binary.BigEndian, &chunk)
+        if err != nil {
+            return nil, nil, err
+        }
+
+        // Unknown chunks are skipped
+        if string(chunk.ID[:]) != "MTrk" {
+            _, err = io.CopyN(ioutil.Discard, r, int64(chunk.Size))
+            if err != nil {
+                return nil, nil, err
+            }
+            continue
+        }
+        data, err := readChunk(r, chunk.Size)
+        if err != nil {
+            return nil, nil, err
+        }
+        track, err := parseTrack(data)
+        if err != nil {
+            return nil, nil, fmt.Errorf("Track %d: %v", i+1, err)
+        }
+        events = append(events, track...)
+        i++
+    }
+    sort.SliceStable(events, func(i, j int) bool { return events[i].time < events[j].time })
+
+    name := opts.Name
+    named := false
+    tempo := 0.0
+    var tempos []TempoChange
+    signature := ""
+    accent := opts.AccentVelocity
+    if accent == 0 {
+        accent = DefaultAccentVelocity
+    }
+    steps := opts.StepsPerBeat
+    if steps <= 0 {
+        steps = DefaultImportSteps
+    }
+
+    // MIDI ticks per song tick
+    division := float64(header.Division) / float64(steps)
+    length := 0
+    beats := map[int]*Beat{}
+    var unmapped []Unmapped
+
+    for _, e := range events {
+        switch {
+        case e.data[0] == 0xFF && e.data[1] == 0x03:
+            // First track name names the song
+            if text := metaData(e.data); !named && len(text) > 0 {
+                name = string(text)
+                named = true
+            }
+        case e.data[0] == 0xFF && e.data[1] == 0x51:
+            // First tempo sets the song tempo and later ones its tempo map,
+            // kept to hundredths of a beat per minute
+            if mpq := metaData(e.data); len(mpq) == 3 {
+                us := int(mpq[0])<<16 | int(mpq[1])<<8 | int(mpq[2])
+                if us <= 0 {
+                    continue
+                }
+                bpm := math.Round(6000000000/float64(us)) / 100
+                tick := int(math.Round(float64(e.time)/division)) + 1
+                switch {
+                case tempo == 0:
+                    tempo = bpm
+                case len(tempos) > 0 && tempos[len(tempos)-1].Tick == tick:
+                    tempos[len(tempos)-1].BPM = bpm
+                case len(tempos) == 0 && bpm == tempo, len(tempos) > 0 && bpm == tempos[len(tempos)-1].BPM:
+                    // Not a change
+                default:
+                    tempos = append(tempos, TempoChange{Tick: tick, BPM: bpm})
+                }
+            }
+        case e.data[0] == 0xFF && e.data[1] == 0x58:
+            // First time signature sets the song time signature
+            if ts := metaData(e.data); signature == "" && len(ts) == 4 && ts[0] > 0 && ts[1] < 8 {
+                signature = fmt.Sprintf("%d/%d", ts[0], 1<<ts[1])
+            }
+        case e.data[0] == 0xFF && e.data[1] == 0x2F:
+            // The longest track sets the pattern length
+            if ticks := int(math.Round(float64(e.time) / division)); ticks > length {
+                length = ticks
+            }
+        case e.data[0] == 0x90|midiDrumChannel && e.data[2] > 0:
+            tick := int(math.Round(float64(e.time)/division)) + 1
+            key := e.data[1]
+
+            n, ok := gmImport[key]
+            if !ok {
+                unmapped = append(unmapped, Unmapped{tick, int(key), "no matching instrument"})
+                continue
+            }
+
+            beat, ok := beats[tick]
+            if !ok {
+                beat = &Beat{Tick: tick}
+                beats[tick] = beat
+            }
+            if v := beat.value(n.field); v != 0 && v != n.value {
+                unmapped = append(unmapped, Unmapped{tick, int(key), "instrument already playing on this tick"})
+                continue
+            }
+            beat.set(n.field, n.value)
+            velocity := int(e.data[2])
+            if velocity > accent {
+                beat.Accent = acOn
+            }
+            // Keep any velocity other than the ones export writes for the
+            // normal and accented levels
+            if velocity != midiVelocity && velocity != midiAccent {
+                beat.setVelocity(n.field, velocity)
+            }
+        }
+    }
+
+    if tempo == 0 {
+        tempo = 120
+    }
+
+    var song []Beat
+    for _, beat := range beats {
+        song = append(song, *beat)
+    }
+
+    s := Song{
+        Version:      CurrentVersion,
+        Name:         name,
+        Tempo:        tempo,
+        Tempos:       tempos,
+        StepsPerBeat: steps,
+        Signature:    signature,
+        Beats:        song,
+    }
+    // Keep trailing empty ticks when the file runs past its last note
+    if length > s.Ticks() {
+        s.Length = length
+    }
+
+    err = s.validate()
+    if err != nil {
+        return nil, nil, err
+    }
+    return &s, unmapped, nil
+}
+
+// parseTrack parses the events of a track chunk into events at absolute times.
+// Channel messages are normalized to always include their status byte.
+func parseTrack(data []byte) ([]midiEvent, error) {
+    var events []midiEvent
+    time := 0
+    status := byte(0)
+
+    for i := 0; i < len(data); {
+        delta, n := readVarLen(data[i:])
+        if n == 0 {
+            return nil, errors.New("Truncated delta time")
+        }
+        i += n
+        time += delta
+
+        if i >= len(data) {
+            return nil, errors.New("Truncated event")
+        }
+
+        // Running status reuses the last channel status byte
+        if data[i]&0x80 != 0 {
+            status = data[i]
+            i++
+        } else if status == 0 {
+            return nil, errors.New("Running status without a status byte")
+        }
+
+        switch {
+        case status == 0xFF:
+            if i >= len(data) {
+                return nil, errors.New("Truncated meta event")
+            }
+            kind := data[i]
+            length, n := readVarLen(data[i+1:])
+            end := i + 1 + n + length
+            if n == 0 || end > len(data) {
+                return nil, errors.New("Truncated meta event")
+            }
+            events = append(events, midiEvent{time, append([]byte{0xFF}, data[i:end]...)})
+            i = end
+            // Meta and system events cancel running status
+            status = 0
+            if kind == 0x2F {
+                return events, nil
+            }
+        case status == 0xF0 || status == 0xF7:
+            length, n := readVarLen(data[i:])
+            if n == 0 || i+n+length > len(data) {
+                return nil, errors.New("Truncated system exclusive event")
+            }
+            i += n + length
+            status = 0
+        default:
+            size := 2
+            if status&0xF0 == 0xC0 || status&0xF0 == 0xD0 {
+                size = 1
+            }
+            if i+size > len(data) {
+                return nil, errors.New("Truncated channel event")
+            }
+            events = append(events, midiEvent{time, append([]byte{status}, data[i:i+size]...)})
+            i += size
+        }
+    }
+
+    return events, nil
+}
+
+// metaData gives the data of a meta event
+func metaData(event []byte) []byte {
+    _, n := readVarLen(event[2:])
+    return event[2+n:]
+}
+
+// readVarLen reads a MIDI variable length quantity, giving its value and the
+// number of bytes read. No bytes are read when the quantity is truncated.
+func readVarLen(b []byte) (int, int) {
+    v := 0
+    for i := 0; i < len(b) && i < 4; i++ {
+        v = v<<7 | int(b[i]&0x7F)
+        if b[i]&0x80 == 0 {
+            return v, i + 1
+        }
+    }
+    return 0, 0
+}
@@ -0,0 +1,337 @@
+package beats_test
+
+import (
+    "bytes"
+    "encoding/binary"
+    "log"
+    "os"
+    "testing"
+
+    "github.com/cody-s-lee/beats/beats"
+    "github.com/google/go-cmp/cmp"
+)
+
+// TestWriteSMF verifies a song is written as a Type 0 Standard MIDI File with
+// its tempo and drum notes
+func TestWriteSMF(t *testing.T) {
+    song, err := beats.NewSong("smf", 120, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1},
+        beats.Beat{Tick: 2, HiHat: 2, Accent: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var buf bytes.Buffer
+    err = song.WriteSMF(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    data := buf.Bytes()
+
+    if string(data[0:4]) != "MThd" {
+        t.Fatalf("Expected MThd header but got %q", data[0:4])
+    }
+    if format := binary.BigEndian.Uint16(data[8:10]); format != 0 {
+        t.Errorf("Expected format 0 but got %d", format)
+    }
+    if tracks := binary.BigEndian.Uint16(data[10:12]); tracks != 1 {
+        t.Errorf("Expected 1 track but got %d", tracks)
+    }
+    if string(data[14:18]) != "MTrk" {
+        t.Fatalf("Expected MTrk chunk but got %q", data[14:18])
+    }
+    if size := int(binary.BigEndian.Uint32(data[18:22])); size != len(data)-22 {
+        t.Errorf("Expected track size of %d but got %d", len(data)-22, size)
+    }
+
+    // 120 bpm is 500000 microseconds per quarter note
+    if !bytes.Contains(data, []byte{0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20}) {
+        t.Error("Expected a tempo of 500000 microseconds per quarter note")
+    }
+
+    // Bass drum 1 and an accented open hi-hat on channel 10
+    if !bytes.Contains(data, []byte{0x99, 36, 96}) {
+        t.Error("Expected a bass drum note on")
+    }
+    if !bytes.Contains(data, []byte{0x99, 46, 127}) {
+        t.Error("Expected an accented open hi-hat note on")
+    }
+
+    if !bytes.HasSuffix(data, []byte{0xFF, 0x2F, 0x00}) {
+        t.Error("Expected the track to end with an end of track event")
+    }
+}
+
+// TestReadSMFRoundTrip verifies a song written as a MIDI file reads back as
+// the same song. An accent on a tick with no notes has nothing to carry it in
+// MIDI so it is lost, but the length of the song keeps its tick. The default
+// step resolution and time signature come back explicitly.
+func TestReadSMFRoundTrip(t *testing.T) {
+    reader, err := os.Open("testdata/all-notes.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var buf bytes.Buffer
+    err = song.WriteSMF(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    imported, unmapped, err := beats.ReadSMF(&buf, beats.ImportOptions{StepsPerBeat: song.Steps()})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(unmapped) != 0 {
+        t.Errorf("Expected no unmapped notes but got %v", unmapped)
+    }
+    song.Length = song.Ticks()
+    song.StepsPerBeat = 1
+    song.Signature = "4/4"
+    song.Beats = song.Beats[:len(song.Beats)-1]
+    if diff := cmp.Diff(song, imported); diff != "" {
+        t.Errorf("Imported song differs from the exported song (-want +got):\n%s", diff)
+    }
+}
+
+// TestReadSMF verifies that a Type 1 file is quantized onto ticks of a quarter
+// note, that loud notes set the accent and that unmapped notes are reported
+func TestReadSMF(t *testing.T) {
+    // Tempo track followed by a drum track at 480 ticks per quarter note
+    tempo := []byte{
+        0x00, 0xFF, 0x51, 0x03, 0x09, 0x27, 0xC0, // 100 bpm
+        0x00, 0xFF, 0x2F, 0x00,
+    }
+    drums := []byte{
+        0x00, 0xFF, 0x03, 0x04, 'l', 'o', 'o', 'p',
+        0x0A, 0x99, 36, 90, // bass drum a little late for tick 1
+        0x83, 0x5A, 42, 120, // closed hi-hat a little early for tick 2, running status
+        0x00, 61, 100, // bongo has no instrument
+        0x00, 0x99, 46, 80, // open hi-hat collides with closed hi-hat
+        0x00, 0x89, 42, 0,
+        0x00, 0x91, 38, 100, // snare on another channel is ignored
+        0x00, 0xFF, 0x2F, 0x00,
+    }
+
+    var buf bytes.Buffer
+    buf.WriteString("MThd")
+    binary.Write(&buf, binary.BigEndian, []uint32{6})
+    binary.Write(&buf, binary.BigEndian, []uint16{1, 2, 480})
+    for _, track := range [][]byte{tempo, drums} {
+        buf.WriteString("MTrk")
+        binary.Write(&buf, binary.BigEndian, uint32(len(track)))
+        buf.Write(track)
+    }
+
+    song, unmapped, err := beats.ReadSMF(&buf, beats.ImportOptions{Name: "unnamed", StepsPerBeat: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if song.Name != "loop" {
+        t.Errorf("Expected song name loop but got %s", song.Name)
+    }
+    if song.Tempo != 100 {
+        t.Errorf("Expected tempo of 100 but got %g", song.Tempo)
+    }
+
+    // Notes keep their velocity and a loud one accents its tick
+    want := []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1, BassDrumVelocity: 90},
+        beats.Beat{Tick: 2, HiHat: 1, Accent: 1, HiHatVelocity: 120},
+    }
+    if diff := cmp.Diff(want, song.Beats); diff != "" {
+        t.Errorf("Unexpected beats (-want +got):\n%s", diff)
+    }
+
+    if len(unmapped) != 2 {
+        t.Fatalf("Expected 2 unmapped notes but got %v", unmapped)
+    }
+    if unmapped[0].Key != 61 || unmapped[0].Tick != 2 {
+        t.Errorf("Expected note 61 on tick 2 to be unmapped but got %s", unmapped[0])
+    }
+    if unmapped[1].Key != 46 || unmapped[1].Tick != 2 {
+        t.Errorf("Expected note 46 on tick 2 to be unmapped but got %s", unmapped[1])
+    }
+}
+
+// TestReadSMFNotMIDI verifies we fail to import a file that is not MIDI
+func TestReadSMFNotMIDI(t *testing.T) {
+    reader, err := os.Open("testdata/cowbell.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    _, _, err = beats.ReadSMF(reader, beats.ImportOptions{Name: "cowbell"})
+    if err == nil {
+        t.Fatal("Expected an error")
+    }
+}
+
+// TestReadSMFTruncated verifies we fail to import a file whose chunks claim
+// more bytes than the file holds
+func TestReadSMFTruncated(t *testing.T) {
+    for _, id := range []string{"MTrk", "XFIH"} {
+        var buf bytes.Buffer
+        buf.WriteString("MThd")
+        binary.Write(&buf, binary.BigEndian, []uint32{6})
+        binary.Write(&buf, binary.BigEndian, []uint16{0, 1, 96})
+        buf.WriteString(id)
+        binary.Write(&buf, binary.BigEndian, []uint32{0xFFFFFFF0})
+        buf.Write([]byte{0x00, 0xFF, 0x2F, 0x00})
+
+        _, _, err := beats.ReadSMF(&buf, beats.ImportOptions{})
+        if err == nil {
+            t.Errorf("Expected an error reading a huge %s chunk", id)
+        }
+    }
+}
+
+// TestSMFSteps verifies that sixteenth note songs export and import on a
+// sixteenth note grid with their time signature
+func TestSMFSteps(t *testing.T) {
+    song, err := beats.NewSong("sixteenths", 120, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1},
+        beats.Beat{Tick: 2, HiHat: 1},
+        beats.Beat{Tick: 7, SnareDrum: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    song.StepsPerBeat = 4
+    song.Signature = "3/4"
+    song.Length = 12
+
+    var buf bytes.Buffer
+    err = song.WriteSMF(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The hi-hat lands a sixteenth note after the bass drum
+    if !bytes.Contains(buf.Bytes(), []byte{0x99, 36, 96, 12, 0x89, 36, 0, 12, 0x99, 42, 96}) {
+        t.Error("Expected notes a sixteenth note apart")
+    }
+
+    imported, _, err := beats.ReadSMF(&buf, beats.ImportOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff := cmp.Diff(song, imported); diff != "" {
+        t.Errorf("Imported song differs from the exported song (-want +got):\n%s", diff)
+    }
+}
+
+// TestSMFVelocity verifies that instrument velocities are written as note
+// velocities and read back
+func TestSMFVelocity(t *testing.T) {
+    song, err := beats.NewSong("ghost", 120, []beats.Beat{
+        beats.Beat{Tick: 1, SnareDrum: 1, SnareDrumVelocity: 30},
+        beats.Beat{Tick: 2, SnareDrum: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var buf bytes.Buffer
+    err = song.WriteSMF(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    imported, _, err := beats.ReadSMF(&buf, beats.ImportOptions{StepsPerBeat: song.Steps()})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if v := imported.Beats[0].SnareDrumVelocity; v != 30 {
+        t.Errorf("Expected snare velocity of 30 but got %d", v)
+    }
+    if v := imported.Beats[1].SnareDrumVelocity; v != 0 {
+        t.Errorf("Expected no snare velocity but got %d", v)
+    }
+}
+
+// noteOn is a note on event at its absolute time in MIDI ticks
+type noteOn struct {
+    time     int
+    key      byte
+    velocity byte
+}
+
+// noteOns gives the note on events of the track of a file written by
+// WriteSMF, which writes the status byte of every event
+func noteOns(t *testing.T, data []byte) []noteOn {
+    var ons []noteOn
+    track := data[22:]
+    time := 0
+    varLen := func(i int) (int, int) {
+        v := 0
+        for ; track[i]&0x80 != 0; i++ {
+            v = v<<7 | int(track[i]&0x7F)
+        }
+        return v<<7 | int(track[i]), i + 1
+    }
+    for i := 0; i < len(track); {
+        delta, n := varLen(i)
+        time += delta
+        switch status := track[n]; {
+        case status == 0xFF:
+            length, end := varLen(n + 2)
+            i = end + length
+        case status&0xF0 == 0x90:
+            ons = append(ons, noteOn{time, track[n+1], track[n+2]})
+            i = n + 3
+        case status&0xF0 == 0x80:
+            i = n + 3
+        default:
+            t.Fatalf("Unexpected status %#x at %d", status, n)
+        }
+    }
+    return ons
+}
+
+// TestSMFFlam verifies that a flammed note is written on the grid with its
+// soft grace note just ahead of it
+func TestSMFFlam(t *testing.T) {
+    song, err := beats.NewSong("flam", 120, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1},
+        beats.Beat{Tick: 2, SnareDrum: 1, SnareDrumArticulation: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var buf bytes.Buffer
+    err = song.WriteSMF(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Tick 2 starts a step into the song, 96 MIDI ticks to the beat
+    grid := 96 / song.Steps()
+    var grace, main *noteOn
+    for _, on := range noteOns(t, buf.Bytes()) {
+        on := on
+        if on.key != 38 {
+            continue
+        }
+        switch on.velocity {
+        case 48:
+            grace = &on
+        case 96:
+            main = &on
+        }
+    }
+    if main == nil || main.time != grid {
+        t.Fatalf("Expected the flammed snare at %d but got %+v", grid, main)
+    }
+    if grace == nil || grace.time >= grid || grace.time < grid/2 {
+        t.Errorf("Expected the grace note just ahead of %d but got %+v", grid, grace)
+    }
+}
@@ -0,0 +1,80 @@
+package beats
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+)
+
+// CurrentVersion is the version of the song file format written by this
+// package. Files of older versions are upgraded as they are parsed.
+const CurrentVersion = 2
+
+// migration upgrades a song document from one version of the format to the
+// next. The document is the song JSON decoded with numbers kept as
+// json.Number.
+type migration struct {
+    description string
+    migrate     func(doc map[string]interface{})
+}
+
+// migrations holds the migration from each version to the next, starting
+// with version 1. A file without a version is version 1.
+var migrations = []migration{
+    migration{
+        // Version 1 files were all one tick per beat, which is still what a
+        // song without steps plays at, so this changes nothing. It only
+        // records the implicit default in the file.
+        "Write out the step resolution of one tick per beat",
+        func(doc map[string]interface{}) {
+            if _, ok := doc["steps"]; !ok {
+                doc["steps"] = 1
+            }
+        },
+    },
+}
+
+// Upgrade migrates a JSON song document to the current version of the
+// format. It gives the upgraded document along with the version it was. A
+// document that is already current is given back unchanged, as is one that is
+// not a JSON object, which is left for Parse to report.
+func Upgrade(data []byte) ([]byte, int, error) {
+    var doc map[string]interface{}
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.UseNumber()
+    err := dec.Decode(&doc)
+    if err != nil {
+        return data, 0, nil
+    }
+
+    version := 1
+    if v, ok := doc["version"]; ok {
+        n, ok := v.(json.Number)
+        if !ok {
+            return data, 0, nil
+        }
+        i, err := n.Int64()
+        if err != nil {
+            return data, 0, nil
+        }
+        version = int(i)
+    }
+
+    if version < 1 || version > CurrentVersion {
+        return data, version, fmt.Errorf("Song version %d should be between 1 and %d", version, CurrentVersion)
+    }
+    if version == CurrentVersion {
+        return data, version, nil
+    }
+
+    for _, m := range migrations[version-1:] {
+        m.migrate(doc)
+    }
+    doc["version"] = CurrentVersion
+
+    upgraded, err := json.Marshal(doc)
+    if err != nil {
+        return nil, version, err
+    }
+    return upgraded, version, nil
+}
@@ -0,0 +1,79 @@
+package beats_test
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+    "testing"
+
+    "github.com/cody-s-lee/beats/beats"
+)
+
+// TestUpgrade verifies that a version 1 document is migrated to the current
+// version and a current document is left as it is
+func TestUpgrade(t *testing.T) {
+    data := []byte(`{"name": "old", "tempo": 120, "beats": [{"tick": 1, "bd": 1}]}`)
+    upgraded, version, err := beats.Upgrade(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if version != 1 {
+        t.Errorf("Expected version 1 but got %d", version)
+    }
+
+    var doc map[string]interface{}
+    err = json.Unmarshal(upgraded, &doc)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if doc["version"] != float64(beats.CurrentVersion) {
+        t.Errorf("Expected version %d but got %v", beats.CurrentVersion, doc["version"])
+    }
+    if doc["steps"] != float64(1) {
+        t.Errorf("Expected 1 step per beat but got %v", doc["steps"])
+    }
+
+    again, version, err := beats.Upgrade(upgraded)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if version != beats.CurrentVersion || string(again) != string(upgraded) {
+        t.Error("Expected a current document to be left as it is")
+    }
+}
+
+// TestParseUpgrades verifies that parsing an old song file upgrades it
+func TestParseUpgrades(t *testing.T) {
+    reader, err := os.Open("testdata/cowbell.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if song.Version != beats.CurrentVersion {
+        t.Errorf("Expected version %d but got %d", beats.CurrentVersion, song.Version)
+    }
+    if song.StepsPerBeat != 1 {
+        t.Errorf("Expected 1 step per beat but got %d", song.StepsPerBeat)
+    }
+}
+
+// TestParseUnknownVersion verifies that a file from a newer version of the
+// format, or one giving a version of 0, is rejected
+func TestParseUnknownVersion(t *testing.T) {
+    for _, version := range []int{0, 99} {
+        _, err := beats.Parse(strings.NewReader(fmt.Sprintf(`{"version": %d, "name": "new", "tempo": 120}`, version)))
+        verr, ok := err.(*beats.ValidationError)
+        if !ok {
+            t.Fatalf("Expected a validation error for version %d but got %v", version, err)
+        }
+        if verr.Problems[0].Code != beats.CodeVersion {
+            t.Errorf("Expected code %s for version %d but got %s", beats.CodeVersion, version, verr.Problems[0].Code)
+        }
+    }
+}
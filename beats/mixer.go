@@ -0,0 +1,93 @@
+package beats
+
+import (
+    "math"
+    "time"
+)
+
+// Mixer turns a sequence of beats into a continuous stream of samples. Notes
+// ring on past the end of their own tick and are mixed into the ticks that
+// follow them.
+type Mixer struct {
+    kit        *Kit
+    sampleRate int
+    voices     map[note][]float64
+    pending    []float64
+    elapsed    time.Duration
+    written    int
+}
+
+// NewMixer creates a mixer using the samples in kit. A nil kit uses the
+// synthesized voices for every instrument.
+func NewMixer(kit *Kit, sampleRate int) *Mixer {
+    return &Mixer{
+        kit:        kit,
+        sampleRate: sampleRate,
+        voices:     map[note][]float64{},
+    }
+}
+
+// Mix mixes the notes of a beat and gives the samples for the next d of time.
+// Notes are played at the level of the velocity they are struck with, which
+// is the accented level on an accented tick and otherwise the normal level
+// unless they have a velocity of their own. Flams and ratchets are struck at
+// their places within d, and the grace notes of flams on the beat that
+// follows, next, at the end of d ahead of it.
+func (m *Mixer) Mix(beat Beat, next Beat, d time.Duration) []float64 {
+    for _, h := range beat.strikes(next, d) {
+        at := int(math.Round(h.offset.Seconds() * float64(m.sampleRate)))
+        for _, f := range insts {
+            if f == accentField {
+                continue
+            }
+            v := h.beat.value(f)
+            if v == 0 {
+                continue
+            }
+            m.add(m.voice(f, v), velocityLevel(h.beat.strike(f)), at)
+        }
+    }
+
+    // Track time rather than samples per tick so rounding never drifts
+    m.elapsed += d
+    end := int(math.Round(m.elapsed.Seconds() * float64(m.sampleRate)))
+    n := end - m.written
+    m.written = end
+
+    return m.take(n)
+}
+
+// Flush gives the samples still ringing after the last mixed beat
+func (m *Mixer) Flush() []float64 {
+    return m.take(len(m.pending))
+}
+
+// voice gives the cached voice for an instrument value
+func (m *Mixer) voice(f field, value int) []float64 {
+    n := note{f, value}
+    v, ok := m.voices[n]
+    if !ok {
+        v = m.kit.voice(f, value, m.sampleRate)
+        m.voices[n] = v
+    }
+    return v
+}
+
+// add mixes a voice into the pending samples starting at sample at
+func (m *Mixer) add(voice []float64, level float64, at int) {
+    if at+len(voice) > len(m.pending) {
+        m.pending = append(m.pending, make([]float64, at+len(voice)-len(m.pending))...)
+    }
+    for i, s := range voice {
+        m.pending[at+i] += level * s
+    }
+}
+
+// take removes and returns n samples from the pending samples, padding with
+// silence when fewer are pending
+func (m *Mixer) take(n int) []float64 {
+    out := make([]float64, n)
+    copied := copy(out, m.pending)
+    m.pending = m.pending[copied:]
+    return out
+}
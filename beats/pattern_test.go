@@ -0,0 +1,92 @@
+package beats_test
+
+import (
+    "bytes"
+    "log"
+    "os"
+    "testing"
+
+    "github.com/cody-s-lee/beats/beats"
+    "github.com/google/go-cmp/cmp"
+)
+
+// TestParseChain verifies that a song with a chain is arranged into one long
+// pattern with every repeat laid end to end
+func TestParseChain(t *testing.T) {
+    reader, err := os.Open("testdata/chain.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(song.Patterns) != 2 {
+        t.Errorf("Expected 2 patterns but got %d", len(song.Patterns))
+    }
+
+    // Twice through the four tick verse then the two tick fill
+    if song.Ticks() != 10 {
+        t.Errorf("Expected 10 ticks but got %d", song.Ticks())
+    }
+
+    arranged := song.Arrange()
+    expected := []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1},
+        beats.Beat{Tick: 3, SnareDrum: 1},
+        beats.Beat{Tick: 5, BassDrum: 1},
+        beats.Beat{Tick: 7, SnareDrum: 1},
+        beats.Beat{Tick: 9, SnareDrum: 1},
+        beats.Beat{Tick: 10, SnareDrum: 2},
+    }
+    if diff := cmp.Diff(expected, arranged.Beats); diff != "" {
+        t.Errorf("Arranged beats mismatch (-want +got):\n%s", diff)
+    }
+    if arranged.Length != 10 {
+        t.Errorf("Expected an arranged length of 10 but got %d", arranged.Length)
+    }
+    if len(arranged.Chain) != 0 || len(arranged.Patterns) != 0 {
+        t.Error("Expected the arranged song to have no chain or patterns")
+    }
+}
+
+// TestParseUnknownPattern verifies that a chain may only play the song's
+// patterns
+func TestParseUnknownPattern(t *testing.T) {
+    reader, err := os.Open("testdata/unknown-pattern.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    _, err = beats.Parse(reader)
+    if err == nil {
+        t.Fatal("Expected an error")
+    }
+}
+
+// TestChainWithBeats verifies that a song with a chain keeps its beats in
+// patterns
+func TestChainWithBeats(t *testing.T) {
+    song, err := beats.NewSong("beats", 120, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    song.Patterns = []beats.Pattern{
+        beats.Pattern{Name: "A", Beats: []beats.Beat{beats.Beat{Tick: 1, SnareDrum: 1}}},
+    }
+    song.Chain = []beats.Link{beats.Link{Pattern: "A"}}
+
+    var b bytes.Buffer
+    err = song.WriteJSON(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = beats.Parse(&b)
+    if err == nil {
+        t.Fatal("Expected an error")
+    }
+}
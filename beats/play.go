@@ -0,0 +1,125 @@
+package beats
+
+import (
+    "context"
+    "time"
+
+    "github.com/benbjohnson/clock"
+)
+
+// Policy decides what the player does when the consumer is not ready to
+// receive a step
+type Policy int
+
+const (
+    // Block waits for the consumer. Steps after a slow read are released late
+    // and catch up to the schedule as soon as the consumer does.
+    Block Policy = iota
+    // Drop gives the consumer until the next tick is due and then drops the
+    // step so that later steps stay on time.
+    Drop
+)
+
+// PlayOption configures how a song plays
+type PlayOption func(*playConfig)
+
+type playConfig struct {
+    repeat    int
+    policy    Policy
+    tolerance time.Duration
+    onLate    func(Step)
+    onDrop    func(Step)
+}
+
+func newPlayConfig(opts []PlayOption) playConfig {
+    config := playConfig{
+        repeat: 1,
+        policy: Block,
+        onLate: func(Step) {},
+        onDrop: func(Step) {},
+    }
+    for _, opt := range opts {
+        opt(&config)
+    }
+    return config
+}
+
+// WithRepeat plays the pattern n times in a row. Any n less than 1 plays it
+// once.
+func WithRepeat(n int) PlayOption {
+    return func(config *playConfig) {
+        if n < 1 {
+            n = 1
+        }
+        config.repeat = n
+    }
+}
+
+// WithLoop plays the pattern over and over without end
+func WithLoop() PlayOption {
+    return func(config *playConfig) {
+        config.repeat = 0
+    }
+}
+
+// WithPolicy sets the policy for a consumer that is not ready for a step
+func WithPolicy(policy Policy) PlayOption {
+    return func(config *playConfig) {
+        config.policy = policy
+    }
+}
+
+// WithLateHandler calls f for every step released more than tolerance after it
+// was scheduled. The handler runs on the player's goroutine before the step is
+// sent and should return quickly.
+func WithLateHandler(tolerance time.Duration, f func(Step)) PlayOption {
+    return func(config *playConfig) {
+        config.tolerance = tolerance
+        config.onLate = f
+    }
+}
+
+// WithDropHandler calls f for every step dropped under the Drop policy. The
+// handler runs on the player's goroutine and should return quickly.
+func WithDropHandler(f func(Step)) PlayOption {
+    return func(config *playConfig) {
+        config.onDrop = f
+    }
+}
+
+// deliver sends a step according to the policy. Under the Drop policy the
+// step is dropped if it has not been received by the deadline. Delivery gives
+// up when ctx is done.
+func (config playConfig) deliver(ctx context.Context, clock clock.Clock, out chan<- Step, step Step, deadline time.Time) {
+    if step.Late() > config.tolerance {
+        config.onLate(step)
+    }
+
+    switch config.policy {
+    case Drop:
+        wait := deadline.Sub(clock.Now())
+        if wait <= 0 {
+            select {
+            case out <- step:
+            case <-ctx.Done():
+            default:
+                config.onDrop(step)
+            }
+            return
+        }
+
+        timer := clock.Timer(wait)
+        defer timer.Stop()
+        select {
+        case out <- step:
+        case <-timer.C:
+            config.onDrop(step)
+        case <-ctx.Done():
+        }
+    default:
+        select {
+        case out <- step:
+        case <-ctx.Done():
+        }
+    }
+}
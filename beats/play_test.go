@@ -0,0 +1,184 @@
+package beats_test
+
+import (
+    "testing"
+    "time"
+
+    "github.com/benbjohnson/clock"
+    "github.com/cody-s-lee/beats/beats"
+)
+
+// TestPlayOrdered verifies that every tick is delivered exactly once and in
+// order, even when the consumer falls behind
+func TestPlayOrdered(t *testing.T) {
+    var beatList []beats.Beat
+    for tick := 1; tick <= 64; tick += 3 {
+        beatList = append(beatList, beats.Beat{Tick: tick, BassDrum: 1})
+    }
+    // A millisecond per tick
+    song, err := beats.NewSong("ordered", 60000, beatList)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    out := make(chan beats.Step)
+    go song.Play(clock.New(), out)
+
+    tick := 0
+    for step := range out {
+        if step.Tick != tick+1 {
+            t.Fatalf("Expected tick %d but got %d", tick+1, step.Tick)
+        }
+        tick = step.Tick
+
+        // Fall behind every so often
+        if tick%10 == 0 {
+            time.Sleep(5 * time.Millisecond)
+        }
+    }
+
+    if tick != 64 {
+        t.Errorf("Expected to play 64 ticks but played %d", tick)
+    }
+}
+
+// TestPlayLate verifies that steps held up by a slow consumer are reported
+// late with their scheduled and actual times
+func TestPlayLate(t *testing.T) {
+    // Ten milliseconds per tick
+    song, err := beats.NewSong("late", 6000, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1},
+        beats.Beat{Tick: 2, BassDrum: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    late := make(chan beats.Step, 2)
+    out := make(chan beats.Step)
+    go song.Play(clock.New(), out, beats.WithLateHandler(20*time.Millisecond, func(step beats.Step) {
+        late <- step
+    }))
+
+    // Hold up the first step well past the second
+    time.Sleep(50 * time.Millisecond)
+    for range out {
+    }
+
+    select {
+    case step := <-late:
+        if step.Tick != 2 {
+            t.Errorf("Expected tick 2 to be late but got tick %d", step.Tick)
+        }
+        if step.Late() < 20*time.Millisecond {
+            t.Errorf("Expected tick 2 to be at least 20ms late but was %s", step.Late())
+        }
+        if !step.Actual.After(step.Scheduled) {
+            t.Errorf("Expected actual time %s after scheduled time %s", step.Actual, step.Scheduled)
+        }
+    default:
+        t.Fatal("Expected a late step")
+    }
+}
+
+// TestPlayDrop verifies that under the drop policy a step nobody reads by the
+// next tick is dropped and the following step still plays
+func TestPlayDrop(t *testing.T) {
+    song, err := beats.NewSong("drop", 60, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1},
+        beats.Beat{Tick: 2, SnareDrum: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    clock := clock.NewMock()
+    dropped := make(chan beats.Step, 1)
+    out := make(chan beats.Step)
+    go song.Play(clock, out, beats.WithPolicy(beats.Drop), beats.WithDropHandler(func(step beats.Step) {
+        dropped <- step
+    }))
+
+    // Leave the first step unread until the second is due. The player may not
+    // be waiting on the clock yet so keep nudging it forward a tick at a time.
+    var step beats.Step
+    for i := 0; i < 10 && step.Tick == 0; i++ {
+        advance(clock, song.TickDuration(1))
+        select {
+        case step = <-dropped:
+        case <-time.After(100 * time.Millisecond):
+        }
+    }
+    if step.Tick != 1 {
+        t.Fatalf("Expected tick 1 to be dropped but got tick %d", step.Tick)
+    }
+
+    select {
+    case step := <-out:
+        if step.Tick != 2 {
+            t.Errorf("Expected tick 2 but got tick %d", step.Tick)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("Expected tick 2 to play")
+    }
+}
+
+// TestPlayRepeat verifies that a pattern repeats for its whole length,
+// including the empty ticks after its last beat
+func TestPlayRepeat(t *testing.T) {
+    // A millisecond per tick
+    song, err := beats.NewSong("repeat", 60000, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    song.Length = 4
+
+    out := make(chan beats.Step)
+    go song.Play(clock.New(), out, beats.WithRepeat(3))
+
+    n := 0
+    for step := range out {
+        if want := n%4 + 1; step.Tick != want {
+            t.Errorf("Expected tick %d but got %d", want, step.Tick)
+        }
+        if want := n / 4; step.Loop != want {
+            t.Errorf("Expected loop %d but got %d", want, step.Loop)
+        }
+        if bass := step.Beat.BassDrum != 0; bass != (step.Tick == 1) {
+            t.Errorf("Expected bass drum only on tick 1 but got %s on tick %d", step.Beat, step.Tick)
+        }
+        n++
+    }
+
+    if n != 12 {
+        t.Errorf("Expected 12 steps but got %d", n)
+    }
+}
+
+// TestPlayLoop verifies that a looping pattern keeps playing
+func TestPlayLoop(t *testing.T) {
+    // A millisecond per tick
+    song, err := beats.NewSong("loop", 60000, []beats.Beat{
+        beats.Beat{Tick: 2, SnareDrum: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    out := make(chan beats.Step)
+    go song.Play(clock.New(), out, beats.WithLoop())
+
+    for loop := 0; loop < 5; loop++ {
+        for tick := 1; tick <= 2; tick++ {
+            step, ok := <-out
+            if !ok {
+                t.Fatal("Output channel should be open")
+            }
+            if step.Tick != tick || step.Loop != loop {
+                t.Fatalf("Expected tick %d of loop %d but got tick %d of loop %d", tick, loop, step.Tick, step.Loop)
+            }
+        }
+    }
+}
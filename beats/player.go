@@ -0,0 +1,359 @@
+package beats
+
+import (
+    "context"
+    "errors"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/benbjohnson/clock"
+)
+
+// Player plays a song under the control of its owner. Steps are delivered on
+// the channel given by Steps in tick order, and the channel is closed when
+// the song ends, the player is stopped or the context it was started with is
+// done. A player runs only once.
+type Player struct {
+    clock   clock.Clock
+    config  playConfig
+    out     chan Step
+    control chan struct{}
+    done    chan struct{}
+
+    mu        sync.Mutex
+    song      Song
+    started   bool
+    cancel    context.CancelFunc
+    ticks     int
+    tick      int
+    loop      int
+    tickStart time.Time
+    paused    bool
+    pausedAt  time.Time
+    subs      []Step
+}
+
+// NewPlayer creates a player for a song. The clock parameter allows you to use
+// a specific clock such as a mock clock for testing. The options are the same
+// as for Play.
+func NewPlayer(song Song, clock clock.Clock, opts ...PlayOption) *Player {
+    return newPlayer(song, clock, make(chan Step), opts)
+}
+
+func newPlayer(song Song, clock clock.Clock, out chan Step, opts []PlayOption) *Player {
+    song = playable(song)
+    return &Player{
+        clock:   clock,
+        config:  newPlayConfig(opts),
+        out:     out,
+        control: make(chan struct{}, 1),
+        done:    make(chan struct{}),
+        song:    song,
+        ticks:   song.Ticks(),
+        tick:    1,
+    }
+}
+
+// Steps gives the channel the steps of the song are delivered on
+func (p *Player) Steps() <-chan Step {
+    return p.out
+}
+
+// Start starts playing from the current tick. Playing stops when ctx is done.
+func (p *Player) Start(ctx context.Context) error {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if p.started {
+        return errors.New("Player has already been started")
+    }
+    p.started = true
+
+    ctx, p.cancel = context.WithCancel(ctx)
+    p.tickStart = p.clock.Now()
+    if p.paused {
+        p.pausedAt = p.tickStart
+    }
+
+    go func() {
+        defer close(p.done)
+        p.run(ctx)
+    }()
+    return nil
+}
+
+// Stop stops playing and waits for the player to finish. The steps channel is
+// closed by the time Stop returns.
+func (p *Player) Stop() {
+    p.mu.Lock()
+    if !p.started {
+        // Never started so there is nothing to wait for, now or on a later
+        // Stop
+        p.started = true
+        p.cancel = func() {}
+        close(p.out)
+        close(p.done)
+        p.mu.Unlock()
+        return
+    }
+    cancel := p.cancel
+    p.mu.Unlock()
+
+    cancel()
+    <-p.done
+}
+
+// Pause holds playback on the current tick until Resume is called
+func (p *Player) Pause() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if p.paused {
+        return
+    }
+    p.paused = true
+    p.pausedAt = p.clock.Now()
+    p.wake()
+}
+
+// Resume continues playback from where it was paused. The tick that was
+// interrupted keeps the time it had left.
+func (p *Player) Resume() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if !p.paused {
+        return
+    }
+    p.paused = false
+    paused := p.clock.Now().Sub(p.pausedAt)
+    p.tickStart = p.tickStart.Add(paused)
+    for i := range p.subs {
+        p.subs[i].Scheduled = p.subs[i].Scheduled.Add(paused)
+    }
+    p.wake()
+}
+
+// Seek moves playback to the given tick of the pattern, which plays next
+// straight away
+func (p *Player) Seek(tick int) error {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if tick < 1 || tick > p.ticks {
+        return errors.New("Seek tick should be within the song")
+    }
+    p.tick = tick
+    p.subs = nil
+    p.tickStart = p.clock.Now()
+    if p.paused {
+        p.pausedAt = p.tickStart
+    }
+    p.wake()
+    return nil
+}
+
+// SetTempo changes the tempo of the song, replacing its tempo map. The next
+// tick keeps its time and the ticks after it follow at the new tempo.
+func (p *Player) SetTempo(bpm float64) error {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if !(bpm > 0) {
+        return errors.New("Song tempo should be greater than 0")
+    }
+    p.song.Tempo = bpm
+    p.song.Tempos = nil
+    p.wake()
+    return nil
+}
+
+// SetSong replaces the song being played, such as with an edit of it, and
+// keeps playing from the same position. The next tick keeps its time. When
+// the new song is shorter than the position its next pass starts instead.
+func (p *Player) SetSong(song Song) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    p.song = playable(song)
+    p.ticks = p.song.Ticks()
+    if p.tick > p.ticks {
+        p.tick = 1
+        p.loop++
+    }
+    p.wake()
+}
+
+// playable readies a song for a player: the chain is played as one long
+// pattern and the beats are sorted
+func playable(song Song) Song {
+    song = song.Arrange()
+
+    beats := make([]Beat, len(song.Beats))
+    copy(beats, song.Beats)
+    sort.Sort(ByTick(beats))
+    song.Beats = beats
+    return song
+}
+
+// run plays the song until it ends or ctx is done, then closes the steps
+// channel
+func (p *Player) run(ctx context.Context) {
+    defer close(p.out)
+
+    for {
+        p.mu.Lock()
+        paused := p.paused
+        at := p.nextAt()
+        p.mu.Unlock()
+
+        if paused {
+            select {
+            case <-p.control:
+            case <-ctx.Done():
+                return
+            }
+            continue
+        }
+
+        // Wait for the next tick or strike, or for the last tick to run its
+        // course
+        if !p.waitUntil(ctx, at) {
+            if ctx.Err() != nil {
+                return
+            }
+            continue
+        }
+
+        p.mu.Lock()
+        // Start over if the player changed while the timer fired
+        if p.paused || !p.nextAt().Equal(at) {
+            p.mu.Unlock()
+            continue
+        }
+        var step Step
+        var deadline time.Time
+        if len(p.subs) > 0 {
+            step, deadline = p.nextSub()
+        } else {
+            if p.finished() {
+                p.mu.Unlock()
+                return
+            }
+            step, deadline = p.next(at)
+        }
+        p.mu.Unlock()
+
+        p.config.deliver(ctx, p.clock, p.out, step, deadline)
+    }
+}
+
+// finished reports whether every pass of the pattern has played
+func (p *Player) finished() bool {
+    return p.ticks == 0 || p.config.repeat > 0 && p.loop >= p.config.repeat
+}
+
+// next builds the step at the current position, queues the later strikes of
+// its flams and ratchets and the grace notes ahead of the next tick, and moves
+// on to the next tick. It gives the step along with the deadline for its
+// delivery, which is when the next step is due.
+func (p *Player) next(at time.Time) (Step, time.Time) {
+    // Lanes with lengths of their own keep looping from pass to pass
+    step := Step{
+        Tick:      p.tick,
+        Loop:      p.loop,
+        Beat:      p.song.BeatAt(p.loop*p.ticks + p.tick),
+        Scheduled: at,
+        Actual:    p.clock.Now(),
+    }
+    d := p.song.StepDuration(p.tick)
+
+    p.tickStart = p.tickStart.Add(p.song.TickDuration(p.tick))
+    p.tick++
+    if p.tick > p.ticks {
+        p.tick = 1
+        p.loop++
+    }
+    if !p.finished() {
+        step.Next = p.song.BeatAt(p.loop*p.ticks + p.tick)
+    }
+
+    // The strikes at the start of the tick are the step itself
+    sub := 0
+    for _, h := range step.Beat.strikes(step.Next, d) {
+        switch {
+        case h.ahead:
+            p.subs = append(p.subs, Step{
+                Tick:      p.tick,
+                Loop:      p.loop,
+                Sub:       -1,
+                Beat:      h.beat,
+                Scheduled: at.Add(h.offset),
+            })
+        case h.offset > 0:
+            sub++
+            p.subs = append(p.subs, Step{
+                Tick:      step.Tick,
+                Loop:      step.Loop,
+                Sub:       sub,
+                Beat:      h.beat,
+                Scheduled: at.Add(h.offset),
+            })
+        }
+    }
+
+    return step, p.nextAt()
+}
+
+// nextSub takes the next strike within the tick that last played. It gives
+// the step along with the deadline for its delivery.
+func (p *Player) nextSub() (Step, time.Time) {
+    step := p.subs[0]
+    step.Actual = p.clock.Now()
+    p.subs = p.subs[1:]
+    return step, p.nextAt()
+}
+
+// nextAt gives the time the next step is due, either a strike within the tick
+// that last played, including a grace note ahead of the tick at the current
+// position, or that tick itself
+func (p *Player) nextAt() time.Time {
+    if len(p.subs) > 0 {
+        return p.subs[0].Scheduled
+    }
+    return p.due()
+}
+
+// due gives the time the tick at the current position plays, including swing
+func (p *Player) due() time.Time {
+    return p.tickStart.Add(p.song.SwingOffset(p.tick))
+}
+
+// wake interrupts the player while it waits so it picks up changes
+func (p *Player) wake() {
+    select {
+    case p.control <- struct{}{}:
+    default:
+    }
+}
+
+// waitUntil blocks until the clock reaches t. It gives false when interrupted
+// by a change to the player or when ctx is done.
+func (p *Player) waitUntil(ctx context.Context, t time.Time) bool {
+    wait := t.Sub(p.clock.Now())
+    if wait <= 0 {
+        return true
+    }
+
+    timer := p.clock.Timer(wait)
+    defer timer.Stop()
+    select {
+    case <-timer.C:
+        return true
+    case <-p.control:
+        return false
+    case <-ctx.Done():
+        return false
+    }
+}
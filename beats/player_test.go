@@ -0,0 +1,318 @@
+package beats_test
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/benbjohnson/clock"
+    "github.com/cody-s-lee/beats/beats"
+)
+
+// TestPlayerPauseResume verifies that a paused player holds its tick and picks
+// up where it left off when resumed
+func TestPlayerPauseResume(t *testing.T) {
+    song := counting(t, 4)
+    clock := clock.NewMock()
+    player := beats.NewPlayer(song, clock)
+    err := player.Start(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer player.Stop()
+
+    expectTick(t, player, clock, 1)
+    player.Pause()
+
+    // Nothing plays while paused
+    for i := 0; i < 5; i++ {
+        advance(clock, song.TickDuration(1))
+    }
+    select {
+    case step := <-player.Steps():
+        t.Fatalf("Expected no steps while paused but got tick %d", step.Tick)
+    case <-time.After(20 * time.Millisecond):
+    }
+
+    player.Resume()
+    expectTick(t, player, clock, 2)
+    expectTick(t, player, clock, 3)
+}
+
+// TestPlayerSeek verifies that seeking plays the chosen tick next
+func TestPlayerSeek(t *testing.T) {
+    song := counting(t, 8)
+    clock := clock.NewMock()
+    player := beats.NewPlayer(song, clock)
+    err := player.Start(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer player.Stop()
+
+    expectTick(t, player, clock, 1)
+
+    err = player.Seek(6)
+    if err != nil {
+        t.Fatal(err)
+    }
+    expectTick(t, player, clock, 6)
+    expectTick(t, player, clock, 7)
+
+    err = player.Seek(9)
+    if err == nil {
+        t.Fatal("Expected an error seeking past the end of the song")
+    }
+}
+
+// TestPlayerSetTempo verifies that changing the tempo changes the time between
+// ticks
+func TestPlayerSetTempo(t *testing.T) {
+    song := counting(t, 4)
+    clock := clock.NewMock()
+    player := beats.NewPlayer(song, clock)
+    err := player.Start(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer player.Stop()
+
+    first := expectTick(t, player, clock, 1)
+
+    // Double time once the first tick has played
+    err = player.SetTempo(song.Tempo * 2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    second := expectTick(t, player, clock, 2)
+    third := expectTick(t, player, clock, 3)
+
+    d := song.TickDuration(1)
+    if got := second.Scheduled.Sub(first.Scheduled); got != d {
+        t.Errorf("Expected %s before the second tick but got %s", d, got)
+    }
+    if got := third.Scheduled.Sub(second.Scheduled); got != d/2 {
+        t.Errorf("Expected %s before the third tick but got %s", d/2, got)
+    }
+
+    err = player.SetTempo(0)
+    if err == nil {
+        t.Fatal("Expected an error setting a zero tempo")
+    }
+}
+
+// TestPlayerSetSong verifies that a player picks up an edited song on the
+// next tick and starts the next pass when the song gets shorter
+func TestPlayerSetSong(t *testing.T) {
+    song := counting(t, 4)
+    clock := clock.NewMock()
+    player := beats.NewPlayer(song, clock, beats.WithLoop())
+    err := player.Start(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer player.Stop()
+
+    expectTick(t, player, clock, 1)
+    expectTick(t, player, clock, 2)
+
+    edited := counting(t, 3)
+    edited.Beats[2].SnareDrum = 1
+    player.SetSong(edited)
+    if step := expectTick(t, player, clock, 3); step.Beat.SnareDrum != 1 {
+        t.Errorf("Expected the edited tick 3 but got %s", step.Beat)
+    }
+
+    player.SetSong(counting(t, 2))
+    if step := expectTick(t, player, clock, 1); step.Loop != 1 {
+        t.Errorf("Expected the second pass but got pass %d", step.Loop)
+    }
+}
+
+// TestPlayerStop verifies that stopping a player closes its steps channel even
+// when nobody is reading
+func TestPlayerStop(t *testing.T) {
+    song := counting(t, 4)
+    player := beats.NewPlayer(song, clock.NewMock())
+    err := player.Start(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    err = player.Start(context.Background())
+    if err == nil {
+        t.Fatal("Expected an error starting a player twice")
+    }
+
+    stopped := make(chan struct{})
+    go func() {
+        player.Stop()
+        close(stopped)
+    }()
+
+    select {
+    case <-stopped:
+    case <-time.After(time.Second):
+        t.Fatal("Expected the player to stop")
+    }
+
+    if _, ok := <-player.Steps(); ok {
+        t.Fatal("Expected the steps channel to be closed")
+    }
+}
+
+// TestPlayerStopUnstarted verifies that a player never started can be stopped,
+// more than once, and closes its steps channel
+func TestPlayerStopUnstarted(t *testing.T) {
+    player := beats.NewPlayer(counting(t, 4), clock.NewMock())
+    player.Stop()
+    player.Stop()
+
+    if _, ok := <-player.Steps(); ok {
+        t.Fatal("Expected the steps channel to be closed")
+    }
+    if err := player.Start(context.Background()); err == nil {
+        t.Fatal("Expected an error starting a stopped player")
+    }
+}
+
+// TestPlayerContext verifies that a player stops when its context is cancelled
+func TestPlayerContext(t *testing.T) {
+    song := counting(t, 4)
+    player := beats.NewPlayer(song, clock.NewMock(), beats.WithLoop())
+
+    ctx, cancel := context.WithCancel(context.Background())
+    err := player.Start(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cancel()
+
+    timeout := time.After(time.Second)
+    for {
+        select {
+        case _, ok := <-player.Steps():
+            if !ok {
+                return
+            }
+        case <-timeout:
+            t.Fatal("Expected the steps channel to be closed")
+        }
+    }
+}
+
+// counting makes a song with a bass drum on every one of its ticks
+func counting(t *testing.T, ticks int) beats.Song {
+    var beatList []beats.Beat
+    for tick := 1; tick <= ticks; tick++ {
+        beatList = append(beatList, beats.Beat{Tick: tick, BassDrum: 1})
+    }
+    song, err := beats.NewSong("counting", 60, beatList)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return *song
+}
+
+// expectTick waits for the next step from the player, nudging the clock
+// forward until it arrives, and checks it is for the given tick
+func expectTick(t *testing.T, player *beats.Player, clock *clock.Mock, tick int) beats.Step {
+    t.Helper()
+    for i := 0; i < 40; i++ {
+        select {
+        case step := <-player.Steps():
+            if step.Tick != tick {
+                t.Fatalf("Expected tick %d but got %d", tick, step.Tick)
+            }
+            return step
+        case <-time.After(10 * time.Millisecond):
+            advance(clock, 100*time.Millisecond)
+        }
+    }
+    t.Fatalf("Expected tick %d but nothing played", tick)
+    return beats.Step{}
+}
+
+// TestPlayerSwing verifies that swing delays the even ticks as they play
+func TestPlayerSwing(t *testing.T) {
+    song := counting(t, 4)
+    song.Swing = 75
+    clock := clock.NewMock()
+    player := beats.NewPlayer(song, clock)
+    err := player.Start(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer player.Stop()
+
+    var steps []beats.Step
+    for tick := 1; tick <= 4; tick++ {
+        steps = append(steps, expectTick(t, player, clock, tick))
+    }
+
+    d := song.TickDuration(1)
+    want := []time.Duration{d * 3 / 2, d / 2, d * 3 / 2}
+    for i, w := range want {
+        if got := steps[i+1].Scheduled.Sub(steps[i].Scheduled); got != w {
+            t.Errorf("Expected %s between ticks %d and %d but got %s", w, i+1, i+2, got)
+        }
+    }
+}
+
+// TestPlayerArticulations verifies that the strikes of ratchets follow their
+// tick as steps with a Sub, and the grace note of a flam comes ahead of its
+// tick with the flammed note itself on the tick
+func TestPlayerArticulations(t *testing.T) {
+    song, err := beats.NewSong("trap", 60, []beats.Beat{
+        beats.Beat{Tick: 1, HiHat: 1, HiHatArticulation: 3},
+        beats.Beat{Tick: 2, SnareDrum: 1, SnareDrumArticulation: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    clock := clock.NewMock()
+    player := beats.NewPlayer(*song, clock)
+    err = player.Start(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer player.Stop()
+
+    var steps []beats.Step
+    for _, tick := range []int{1, 1, 1, 2, 2} {
+        steps = append(steps, expectTick(t, player, clock, tick))
+    }
+
+    d := song.TickDuration(1)
+    start := steps[0].Scheduled
+    want := []struct {
+        sub int
+        at  time.Duration
+    }{
+        {0, 0},
+        {1, d / 3},
+        {2, d * 2 / 3},
+        {-1, d - 20*time.Millisecond},
+        {0, d},
+    }
+    for i, w := range want {
+        if steps[i].Sub != w.sub {
+            t.Errorf("Expected step %d to be strike %d but got %d", i, w.sub, steps[i].Sub)
+        }
+        if got := steps[i].Scheduled.Sub(start); got != w.at {
+            t.Errorf("Expected step %d at %s but got %s", i, w.at, got)
+        }
+    }
+    if s := steps[0].Beat.String(); s != "hh_closed*3" {
+        t.Errorf("Expected the ratchet to print as hh_closed*3 but got %s", s)
+    }
+    if s := steps[0].Next.String(); s != "snare_1~flam" {
+        t.Errorf("Expected the first tick to look ahead to snare_1~flam but got %s", s)
+    }
+    if s := steps[3].Beat.String(); s != "snare_1@48" {
+        t.Errorf("Expected the grace note to print as snare_1@48 but got %s", s)
+    }
+    if s := steps[4].Beat.String(); s != "snare_1~flam" {
+        t.Errorf("Expected the flam to print as snare_1~flam on its tick but got %s", s)
+    }
+}
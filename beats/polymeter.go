@@ -0,0 +1,134 @@
+package beats
+
+import (
+    "sort"
+    "strings"
+)
+
+// BeatAt gives the beat that plays on the nth tick of playing the song,
+// counting from 1 through every pass of the pattern. An instrument with a
+// lane length of its own loops on it rather than on the pattern, and keeps
+// going from pass to pass, so its notes come from the tick of its lane.
+func (song Song) BeatAt(n int) Beat {
+    return combine(song.Beats, song.Ticks(), song.Lanes, n)
+}
+
+// combine gives the beat on the nth tick of playing a pattern of beats with
+// the given number of ticks and lane lengths
+func combine(beats []Beat, ticks int, lanes map[string]int, n int) Beat {
+    if ticks <= 0 {
+        return Beat{}
+    }
+    tick := (n-1)%ticks + 1
+    beat := Beat{Tick: tick}
+    if b := beatOn(beats, tick); b != nil {
+        beat = *b
+    }
+
+    for code, length := range lanes {
+        lane := findLane(code)
+        if lane == nil || length <= 0 {
+            continue
+        }
+        from := Beat{}
+        if b := beatOn(beats, (n-1)%length+1); b != nil {
+            from = *b
+        }
+        beat.set(lane.field, from.value(lane.field))
+        beat.setVelocity(lane.field, from.velocity(lane.field))
+        beat.setArticulation(lane.field, from.articulation(lane.field))
+    }
+    return beat
+}
+
+// laneTick gives the tick of a pattern that an instrument plays on tick n,
+// which is within its lane when it has a lane length
+func laneTick(lanes map[string]int, f field, n int) int {
+    for code, length := range lanes {
+        if lane := findLane(code); lane != nil && lane.field == f && length > 0 {
+            return (n-1)%length + 1
+        }
+    }
+    return n
+}
+
+// laneLength gives the lane length of an instrument, or 0 when it loops with
+// the pattern
+func laneLength(lanes map[string]int, f field) int {
+    for code, length := range lanes {
+        if lane := findLane(code); lane != nil && lane.field == f {
+            return length
+        }
+    }
+    return 0
+}
+
+// setLaneLength sets the lane length of an instrument, removing it when the
+// length is 0. It gives the lanes, which are made when there are none.
+func setLaneLength(lanes map[string]int, f field, length int) map[string]int {
+    for code := range lanes {
+        if lane := findLane(code); lane != nil && lane.field == f {
+            delete(lanes, code)
+        }
+    }
+    if length <= 0 {
+        if len(lanes) == 0 {
+            return nil
+        }
+        return lanes
+    }
+    if lanes == nil {
+        lanes = map[string]int{}
+    }
+    for _, lane := range gridLanes {
+        if lane.field == f {
+            lanes[strings.ToLower(lane.code)] = length
+        }
+    }
+    return lanes
+}
+
+// checkLanes adds a problem to v for every lane length that is not for a
+// known instrument, is not positive or does not cover the notes of its
+// instrument. The beats and lanes are members of the value at path.
+func checkLanes(v *validator, path string, beats []Beat, lanes map[string]int) {
+    member := "lanes"
+    if path != "" {
+        member = path + ".lanes"
+    }
+
+    // Report in a steady order
+    codes := make([]string, 0, len(lanes))
+    for code := range lanes {
+        codes = append(codes, code)
+    }
+    sort.Strings(codes)
+
+    for _, code := range codes {
+        length := lanes[code]
+        lane := findLane(code)
+        if lane == nil || code != strings.ToLower(lane.code) {
+            v.add(CodeLane, member+"."+code, "Lane %s is not an instrument", code)
+            continue
+        }
+        if length <= 0 {
+            v.add(CodeLaneLength, member+"."+code, "Lane %s length should be greater than 0", code)
+            continue
+        }
+        for _, beat := range beats {
+            if beat.Tick > length && beat.value(lane.field) > 0 {
+                v.add(CodeLaneShort, member+"."+code, "Lane %s length %d should cover its note on tick %d", code, length, beat.Tick)
+                break
+            }
+        }
+    }
+}
+
+// laneCodes gives the JSON codes of the instruments, which name lanes
+func laneCodes() []string {
+    codes := make([]string, len(gridLanes))
+    for i, lane := range gridLanes {
+        codes[i] = strings.ToLower(lane.code)
+    }
+    return codes
+}
@@ -0,0 +1,119 @@
+package beats_test
+
+import (
+    "bytes"
+    "log"
+    "os"
+    "testing"
+
+    "github.com/cody-s-lee/beats/beats"
+    "github.com/google/go-cmp/cmp"
+)
+
+// polymeter gives the song of testdata/polymeter.json, a hi-hat looping on 3
+// ticks against a pattern of 16
+func polymeter(t *testing.T) *beats.Song {
+    reader, err := os.Open("testdata/polymeter.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return song
+}
+
+// TestBeatAt verifies that a lane keeps its own phase from pass to pass of
+// the pattern while the other instruments loop with the pattern
+func TestBeatAt(t *testing.T) {
+    song := polymeter(t)
+
+    tests := []struct {
+        n    int
+        want beats.Beat
+    }{
+        {1, beats.Beat{Tick: 1, BassDrum: 1, HiHat: 2, HiHatVelocity: 60}},
+        {2, beats.Beat{Tick: 2, HiHat: 1}},
+        {3, beats.Beat{Tick: 3}},
+        {4, beats.Beat{Tick: 4, HiHat: 2, HiHatVelocity: 60}},
+        {5, beats.Beat{Tick: 5, SnareDrum: 1, HiHat: 1}},
+        {16, beats.Beat{Tick: 16, HiHat: 2, HiHatVelocity: 60}},
+        {17, beats.Beat{Tick: 1, BassDrum: 1, HiHat: 1}},
+        {49, beats.Beat{Tick: 1, BassDrum: 1, HiHat: 2, HiHatVelocity: 60}},
+    }
+    for _, test := range tests {
+        if diff := cmp.Diff(test.want, song.BeatAt(test.n)); diff != "" {
+            t.Errorf("Tick %d mismatch (-want +got):\n%s", test.n, diff)
+        }
+    }
+}
+
+// TestArrangeLanes verifies that a chain plays the lanes of its patterns
+// through its repeats
+func TestArrangeLanes(t *testing.T) {
+    song := polymeter(t)
+    song.Chain = []beats.Link{beats.Link{Pattern: "A", Repeat: 2}}
+    song.Patterns = []beats.Pattern{beats.Pattern{Name: "A", Length: song.Length, Lanes: song.Lanes, Beats: song.Beats}}
+    song.Beats = nil
+    song.Length = 0
+    song.Lanes = nil
+
+    arranged := song.Arrange()
+    if ticks := arranged.Ticks(); ticks != 32 {
+        t.Fatalf("Expected 32 ticks but got %d", ticks)
+    }
+    for n := 1; n <= 32; n++ {
+        want := beats.HiHat(0)
+        switch (n - 1) % 3 {
+        case 0:
+            want = 2
+        case 1:
+            want = 1
+        }
+        if got := arranged.BeatAt(n).HiHat; got != want {
+            t.Errorf("Expected hi-hat %d on tick %d but got %d", want, n, got)
+        }
+    }
+}
+
+// TestParseLaneShort verifies that a lane must cover the notes of its
+// instrument
+func TestParseLaneShort(t *testing.T) {
+    song := polymeter(t)
+    song.Lanes = map[string]int{"hh": 1}
+
+    var b bytes.Buffer
+    err := song.WriteJSON(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, err = beats.Parse(&b)
+    verr, ok := err.(*beats.ValidationError)
+    if !ok || len(verr.Problems) != 1 || verr.Problems[0].Code != beats.CodeLaneShort {
+        t.Fatalf("Expected a lane problem but got %v", err)
+    }
+    if path := verr.Problems[0].Path; path != "lanes.hh" {
+        t.Errorf("Expected the problem at lanes.hh but got %s", path)
+    }
+}
+
+// TestGridRoundTripLanes verifies that lane lengths survive a grid
+func TestGridRoundTripLanes(t *testing.T) {
+    song := polymeter(t)
+
+    var b bytes.Buffer
+    err := song.WriteGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    got, err := beats.ParseGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff := cmp.Diff(song, got); diff != "" {
+        t.Errorf("Round trip mismatch (-want +got):\n%s", diff)
+    }
+}
@@ -0,0 +1,71 @@
+package beats
+
+import (
+    "errors"
+    "io"
+    "math"
+)
+
+// Levels for notes with and without the accent
+const (
+    normalLevel = 0.6
+    accentLevel = 1.0
+)
+
+// velocityLevel gives the level a note struck with a velocity plays at. The
+// velocity a note is struck with by default plays at the normal level and an
+// accented one at the accented level, so a note is only ever softer for a
+// lower velocity, as it is when exported to MIDI.
+func velocityLevel(v int) float64 {
+    if v <= midiVelocity {
+        return normalLevel * float64(v) / midiVelocity
+    }
+    return normalLevel + (accentLevel-normalLevel)*float64(v-midiVelocity)/(midiAccent-midiVelocity)
+}
+
+// Render renders the song to w as a mono 16-bit PCM WAV file at the given
+// sample rate. Each instrument is synthesized and the accent raises the level
+// of every note on its tick. Swing delays the even ticks. The render covers the
+// whole pattern length and runs on until the last note has decayed.
+func (song Song) Render(w io.Writer, sampleRate int) error {
+    return song.RenderKit(w, sampleRate, nil)
+}
+
+// RenderKit renders the song like Render but plays the samples from kit in
+// place of the synthesized voices
+func (song Song) RenderKit(w io.Writer, sampleRate int, kit *Kit) error {
+    if sampleRate <= 0 {
+        return errors.New("Sample rate should be greater than 0")
+    }
+
+    samples := song.mixdown(NewMixer(kit, sampleRate))
+
+    // Scale down rather than clip when notes pile up
+    peak := 0.0
+    for _, s := range samples {
+        peak = math.Max(peak, math.Abs(s))
+    }
+    if peak > 1 {
+        for i := range samples {
+            samples[i] /= peak
+        }
+    }
+
+    return writeWAV(w, sampleRate, samples)
+}
+
+// mixdown mixes every tick of the song into a single buffer of samples
+func (song Song) mixdown(mixer *Mixer) []float64 {
+    song = song.Arrange()
+
+    var samples []float64
+    for tick := 1; tick <= song.Ticks(); tick++ {
+        var next Beat
+        if tick < song.Ticks() {
+            next = song.BeatAt(tick + 1)
+        }
+        samples = append(samples, mixer.Mix(song.BeatAt(tick), next, song.StepDuration(tick))...)
+    }
+
+    return append(samples, mixer.Flush()...)
+}
@@ -0,0 +1,147 @@
+package beats_test
+
+import (
+    "bytes"
+    "encoding/binary"
+    "testing"
+
+    "github.com/cody-s-lee/beats/beats"
+)
+
+// TestRenderHeader verifies a rendered song is a mono 16-bit WAV file at the
+// requested sample rate that lasts at least as long as the song
+func TestRenderHeader(t *testing.T) {
+    song, err := beats.Default()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var buf bytes.Buffer
+    err = song.Render(&buf, 8000)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    data := buf.Bytes()
+    if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+        t.Fatalf("Expected a RIFF WAVE header but got %q", data[0:12])
+    }
+    if channels := binary.LittleEndian.Uint16(data[22:24]); channels != 1 {
+        t.Errorf("Expected 1 channel but got %d", channels)
+    }
+    if rate := binary.LittleEndian.Uint32(data[24:28]); rate != 8000 {
+        t.Errorf("Expected sample rate of 8000 but got %d", rate)
+    }
+    if bits := binary.LittleEndian.Uint16(data[34:36]); bits != 16 {
+        t.Errorf("Expected 16 bits per sample but got %d", bits)
+    }
+
+    size := int(binary.LittleEndian.Uint32(data[40:44]))
+    if size != len(data)-44 {
+        t.Errorf("Expected data size of %d but got %d", len(data)-44, size)
+    }
+
+    last := song.Beats[len(song.Beats)-1].Tick
+    min := int(song.TickDuration(1).Seconds()*float64(last)*8000) * 2
+    if size < min {
+        t.Errorf("Expected at least %d bytes of samples but got %d", min, size)
+    }
+}
+
+// TestRenderAccent verifies that the accent raises the level of a note
+func TestRenderAccent(t *testing.T) {
+    plain, err := beats.NewSong("plain", 120, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    accented, err := beats.NewSong("accented", 120, []beats.Beat{
+        beats.Beat{Tick: 1, BassDrum: 1, Accent: 1},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if p, a := peak(t, *plain), peak(t, *accented); !(a > p) {
+        t.Errorf("Expected accented peak %d to be greater than plain peak %d", a, p)
+    }
+}
+
+// TestRenderBadSampleRate verifies we fail to render without a positive sample
+// rate
+func TestRenderBadSampleRate(t *testing.T) {
+    song, err := beats.Default()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var buf bytes.Buffer
+    err = song.Render(&buf, 0)
+    if err == nil {
+        t.Fatal("Expected an error")
+    }
+}
+
+// peak renders a song and gives the largest absolute sample value
+func peak(t *testing.T, song beats.Song) int16 {
+    var buf bytes.Buffer
+    err := song.Render(&buf, 8000)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    samples := make([]int16, (buf.Len()-44)/2)
+    err = binary.Read(bytes.NewReader(buf.Bytes()[44:]), binary.LittleEndian, samples)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var max int16
+    for _, s := range samples {
+        if s < 0 {
+            s = -s
+        }
+        if s > max {
+            max = s
+        }
+    }
+    return max
+}
+
+// TestRenderVelocity verifies that a note renders louder the higher its
+// velocity, with the default between the velocities either side of it and an
+// accent as loud as the highest
+func TestRenderVelocity(t *testing.T) {
+    song := func(beat beats.Beat) beats.Song {
+        song, err := beats.NewSong("velocity", 120, []beats.Beat{beat})
+        if err != nil {
+            t.Fatal(err)
+        }
+        return *song
+    }
+
+    // In order from softest to loudest, with one step softer and louder
+    // than the default as the velocity keys of create give
+    ramp := []struct {
+        name string
+        beat beats.Beat
+    }{
+        {"ghost", beats.Beat{Tick: 1, SnareDrum: 1, SnareDrumVelocity: 30}},
+        {"softened", beats.Beat{Tick: 1, SnareDrum: 1, SnareDrumVelocity: 88}},
+        {"default", beats.Beat{Tick: 1, SnareDrum: 1}},
+        {"raised", beats.Beat{Tick: 1, SnareDrum: 1, SnareDrumVelocity: 104}},
+        {"loudest", beats.Beat{Tick: 1, SnareDrum: 1, SnareDrumVelocity: beats.MaxVelocity}},
+    }
+    for i := 1; i < len(ramp); i++ {
+        lo, hi := peak(t, song(ramp[i-1].beat)), peak(t, song(ramp[i].beat))
+        if !(lo < hi) {
+            t.Errorf("Expected %s peak %d to be less than %s peak %d", ramp[i-1].name, lo, ramp[i].name, hi)
+        }
+    }
+
+    loudest := peak(t, song(ramp[len(ramp)-1].beat))
+    if a := peak(t, song(beats.Beat{Tick: 1, SnareDrum: 1, Accent: 1})); a != loudest {
+        t.Errorf("Expected accented peak %d to match the loudest velocity peak %d", a, loudest)
+    }
+}
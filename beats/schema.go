@@ -0,0 +1,273 @@
+package beats
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// instrumentMax gives the largest value of each instrument type and of the
+// velocity and articulation of an instrument
+var instrumentMax = map[reflect.Type]int{
+    reflect.TypeOf(Velocity(0)):           MaxVelocity,
+    reflect.TypeOf(Articulation(0)):       MaxRatchet,
+    reflect.TypeOf(Bass(0)):               int(bdTwo),
+    reflect.TypeOf(Snare(0)):              int(sdTwo),
+    reflect.TypeOf(Tom(0)):                int(tOn),
+    reflect.TypeOf(RimshotCowbell(0)):     int(cowbell),
+    reflect.TypeOf(HandClapTambourine(0)): int(tambourine),
+    reflect.TypeOf(HiHat(0)):              int(open),
+    reflect.TypeOf(Cymbal(0)):             int(ride),
+    reflect.TypeOf(Accent(0)):             int(acOn),
+}
+
+// ParseStrict parses a song from a Reader like Parse, and also rejects fields
+// the song format does not have and instrument values out of range, such as a
+// bass drum of 7
+func ParseStrict(reader io.Reader) (*Song, error) {
+    return parse(reader, true)
+}
+
+// checkStrict adds a problem to v for every member of the JSON source that is
+// not a field of the song format, for every instrument value of the song that
+// is out of range and for every velocity or articulation of a silent
+// instrument
+func (song Song) checkStrict(v *validator, data []byte) {
+    // Report unknown members in the order they appear in the source
+    offsets := jsonOffsets(data)
+    paths := make([]string, 0, len(offsets))
+    for path := range offsets {
+        paths = append(paths, path)
+    }
+    sort.Slice(paths, func(i, j int) bool {
+        return offsets[paths[i]] < offsets[paths[j]]
+    })
+
+    songType := reflect.TypeOf(song)
+    for _, path := range paths {
+        if path == "" || !knownPath(songType, parentPath(path)) {
+            continue
+        }
+        if !knownPath(songType, path) {
+            v.add(CodeUnknownField, path, "Unknown field %s", path[strings.LastIndexAny(path, ".[")+1:])
+        }
+    }
+
+    checkValues(v, "", reflect.ValueOf(song))
+    checkSilent(v, "", song.Beats)
+    for i, pattern := range song.Patterns {
+        checkSilent(v, fmt.Sprintf("patterns[%d].", i), pattern.Beats)
+    }
+}
+
+// checkSilent adds a problem to v for every velocity and articulation given to
+// an instrument that is silent on its tick, which would never be heard. Paths
+// are prefixed with prefix.
+func checkSilent(v *validator, prefix string, beats []Beat) {
+    for i, beat := range beats {
+        for _, lane := range gridLanes {
+            if lane.field == accentField || beat.value(lane.field) != 0 {
+                continue
+            }
+            code := strings.ToLower(lane.code)
+            if beat.velocity(lane.field) != 0 {
+                v.add(CodeSilent, fmt.Sprintf("%sbeats[%d].%sv", prefix, i, code), "Velocity of %s is given but it is silent on tick %d", code, beat.Tick)
+            }
+            if beat.articulation(lane.field) != 0 {
+                v.add(CodeSilent, fmt.Sprintf("%sbeats[%d].%sa", prefix, i, code), "Articulation of %s is given but it is silent on tick %d", code, beat.Tick)
+            }
+        }
+    }
+}
+
+// checkValues adds a problem to v for every instrument value within value
+// that is out of range
+func checkValues(v *validator, path string, value reflect.Value) {
+    switch value.Kind() {
+    case reflect.Struct:
+        for i := 0; i < value.NumField(); i++ {
+            name := jsonName(value.Type().Field(i))
+            if name == "" {
+                continue
+            }
+            if path != "" {
+                name = path + "." + name
+            }
+            checkValues(v, name, value.Field(i))
+        }
+    case reflect.Slice:
+        for i := 0; i < value.Len(); i++ {
+            checkValues(v, fmt.Sprintf("%s[%d]", path, i), value.Index(i))
+        }
+    default:
+        max, ok := instrumentMax[value.Type()]
+        if ok && int(value.Uint()) > max {
+            v.add(CodeValue, path, "Value %d should be between 0 and %d", value.Uint(), max)
+        }
+    }
+}
+
+// knownPath reports whether path is a field of the type t
+func knownPath(t reflect.Type, path string) bool {
+    for path != "" {
+        switch {
+        case path[0] == '[':
+            end := strings.IndexByte(path, ']')
+            if t.Kind() != reflect.Slice || end < 0 {
+                return false
+            }
+            if _, err := strconv.Atoi(path[1:end]); err != nil {
+                return false
+            }
+            t = t.Elem()
+            path = path[end+1:]
+        default:
+            path = strings.TrimPrefix(path, ".")
+            end := strings.IndexAny(path, ".[")
+            if end < 0 {
+                end = len(path)
+            }
+            if t.Kind() == reflect.Map {
+                // Keys are checked by the song itself
+                t = t.Elem()
+                path = path[end:]
+                continue
+            }
+            if t.Kind() != reflect.Struct {
+                return false
+            }
+            field, ok := jsonField(t, path[:end])
+            if !ok {
+                return false
+            }
+            t = field.Type
+            path = path[end:]
+        }
+    }
+    return true
+}
+
+// jsonName gives the JSON name of a struct field, or "" for a field that is
+// not in JSON
+func jsonName(field reflect.StructField) string {
+    if field.PkgPath != "" {
+        return ""
+    }
+    tag := strings.Split(field.Tag.Get("json"), ",")[0]
+    switch tag {
+    case "-":
+        return ""
+    case "":
+        return field.Name
+    }
+    return tag
+}
+
+// jsonField finds the field of the struct type t with the given JSON name
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+    for i := 0; i < t.NumField(); i++ {
+        if jsonName(t.Field(i)) == name {
+            return t.Field(i), true
+        }
+    }
+    return reflect.StructField{}, false
+}
+
+// schemaRequired lists the fields each type of the song format must have
+var schemaRequired = map[reflect.Type][]string{
+    reflect.TypeOf(Song{}):        []string{"name", "tempo"},
+    reflect.TypeOf(Beat{}):        []string{"tick"},
+    reflect.TypeOf(Pattern{}):     []string{"name"},
+    reflect.TypeOf(Link{}):        []string{"pattern"},
+    reflect.TypeOf(TempoChange{}): []string{"tick", "bpm"},
+}
+
+// schemaFields gives the constraints on fields beyond their type, keyed by
+// the type name and JSON name of the field
+var schemaFields = map[string]map[string]interface{}{
+    "Song.version":   {"minimum": 1, "maximum": CurrentVersion},
+    "Song.name":      {"minLength": 1},
+    "Song.tempo":     {"exclusiveMinimum": 0},
+    "Song.steps":     {"minimum": 0},
+    "Song.signature": {"pattern": "^[0-9]+/[0-9]+$"},
+    "Song.swing": {"anyOf": []interface{}{
+        map[string]interface{}{"const": 0},
+        map[string]interface{}{"minimum": MinSwing, "maximum": MaxSwing},
+    }},
+    "Song.length":      {"minimum": 0},
+    "Beat.tick":        {"minimum": 1},
+    "Pattern.name":     {"minLength": 1},
+    "Pattern.length":   {"minimum": 0},
+    "Song.lanes":       lanesSchema,
+    "Pattern.lanes":    lanesSchema,
+    "Link.repeat":      {"minimum": 0},
+    "TempoChange.tick": {"minimum": 1},
+    "TempoChange.bpm":  {"exclusiveMinimum": 0},
+    "TempoChange.ramp": {"enum": []interface{}{RampJump, RampLinear}},
+}
+
+// lanesSchema is the schema of the lane lengths of a song or pattern
+var lanesSchema = map[string]interface{}{
+    "propertyNames":        map[string]interface{}{"enum": laneCodes()},
+    "additionalProperties": map[string]interface{}{"type": "integer", "minimum": 1},
+}
+
+// WriteSchema writes a JSON Schema of the song format, generated from the
+// song types, that ParseStrict agrees with on the fields and value ranges it
+// allows
+func WriteSchema(w io.Writer) error {
+    schema := schemaOf(reflect.TypeOf(Song{}))
+    schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+    schema["title"] = "beats song"
+
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "    ")
+    return enc.Encode(schema)
+}
+
+// schemaOf gives the JSON Schema of a type of the song format
+func schemaOf(t reflect.Type) map[string]interface{} {
+    if max, ok := instrumentMax[t]; ok {
+        return map[string]interface{}{"type": "integer", "minimum": 0, "maximum": max}
+    }
+
+    switch t.Kind() {
+    case reflect.Struct:
+        properties := map[string]interface{}{}
+        for i := 0; i < t.NumField(); i++ {
+            name := jsonName(t.Field(i))
+            if name == "" {
+                continue
+            }
+            property := schemaOf(t.Field(i).Type)
+            for k, v := range schemaFields[t.Name()+"."+name] {
+                property[k] = v
+            }
+            properties[name] = property
+        }
+        schema := map[string]interface{}{
+            "type":                 "object",
+            "properties":           properties,
+            "additionalProperties": false,
+        }
+        if required, ok := schemaRequired[t]; ok {
+            schema["required"] = required
+        }
+        return schema
+    case reflect.Slice:
+        return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+    case reflect.Map:
+        return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+    case reflect.String:
+        return map[string]interface{}{"type": "string"}
+    case reflect.Bool:
+        return map[string]interface{}{"type": "boolean"}
+    case reflect.Float32, reflect.Float64:
+        return map[string]interface{}{"type": "number"}
+    }
+    return map[string]interface{}{"type": "integer"}
+}
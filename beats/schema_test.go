@@ -0,0 +1,111 @@
+package beats_test
+
+import (
+    "bytes"
+    "encoding/json"
+    "log"
+    "os"
+    "testing"
+
+    "github.com/cody-s-lee/beats/beats"
+    "github.com/google/go-cmp/cmp"
+)
+
+// TestParseStrict verifies that strict parsing reports unknown fields and out
+// of range instrument values that Parse lets through
+func TestParseStrict(t *testing.T) {
+    reader, err := os.Open("testdata/typos.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    _, err = beats.Parse(reader)
+    if err != nil {
+        t.Fatalf("Expected the song to parse but got %v", err)
+    }
+
+    reader, err = os.Open("testdata/typos.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    _, err = beats.ParseStrict(reader)
+    verr, ok := err.(*beats.ValidationError)
+    if !ok {
+        t.Fatalf("Expected a validation error but got %v", err)
+    }
+
+    var paths []string
+    for _, p := range verr.Problems {
+        paths = append(paths, string(p.Code)+" "+p.Path)
+    }
+    expected := []string{
+        "unknown-field beats[1].hihat",
+        "unknown-field patterns[0].lenght",
+        "value-range beats[0].bd",
+        "value-range patterns[0].beats[0].cy",
+        "value-silent beats[2].hha",
+        "value-silent beats[2].bdv",
+    }
+    if diff := cmp.Diff(expected, paths); diff != "" {
+        t.Errorf("Problems mismatch (-want +got):\n%s", diff)
+    }
+}
+
+// TestParseStrictValid verifies that strict parsing accepts a valid song
+func TestParseStrictValid(t *testing.T) {
+    for _, fn := range []string{"testdata/all-notes.json", "testdata/chain.json", "testdata/trap.json", "testdata/ramp.json", "testdata/polymeter.json"} {
+        reader, err := os.Open(fn)
+        if err != nil {
+            log.Fatal(err)
+        }
+        _, err = beats.ParseStrict(reader)
+        if err != nil {
+            t.Errorf("Expected %s to parse but got %v", fn, err)
+        }
+    }
+}
+
+// TestWriteSchema verifies that the schema covers the beat fields with their
+// value ranges
+func TestWriteSchema(t *testing.T) {
+    var b bytes.Buffer
+    err := beats.WriteSchema(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var schema struct {
+        Properties struct {
+            Beats struct {
+                Items struct {
+                    Properties map[string]struct {
+                        Maximum *int
+                    }
+                    AdditionalProperties bool
+                }
+            }
+        }
+        Required []string
+    }
+    err = json.Unmarshal(b.Bytes(), &schema)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    beat := schema.Properties.Beats.Items
+    if beat.AdditionalProperties {
+        t.Error("Expected beats to reject additional properties")
+    }
+    expected := map[string]int{
+        "bd": 2, "sd": 2, "lt": 1, "mt": 1, "ht": 1,
+        "rc": 2, "hc": 2, "hh": 2, "cy": 2, "ac": 1,
+    }
+    for name, max := range expected {
+        p, ok := beat.Properties[name]
+        if !ok || p.Maximum == nil || *p.Maximum != max {
+            t.Errorf("Expected %s to have a maximum of %d", name, max)
+        }
+    }
+    if diff := cmp.Diff([]string{"name", "tempo"}, schema.Required); diff != "" {
+        t.Errorf("Required mismatch (-want +got):\n%s", diff)
+    }
+}
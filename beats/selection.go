@@ -0,0 +1,288 @@
+package beats
+
+import (
+    "strings"
+
+    "github.com/nsf/termbox-go"
+)
+
+// modShift marks an arrow key decoded with shift held. Termbox has no shift
+// modifier of its own.
+const modShift termbox.Modifier = 1 << 7
+
+// selectionShade is the background of the cells selected
+const selectionShade = termbox.Attribute(24)
+
+// shiftArrows are the escape sequences after the escape of arrow keys with
+// shift held, which termbox does not know, by the arrow they stand for
+var shiftArrows = map[string]termbox.Key{
+    "[1;2A": termbox.KeyArrowUp,
+    "[1;2B": termbox.KeyArrowDown,
+    "[1;2C": termbox.KeyArrowRight,
+    "[1;2D": termbox.KeyArrowLeft,
+    "[a":    termbox.KeyArrowUp,
+    "[b":    termbox.KeyArrowDown,
+    "[c":    termbox.KeyArrowRight,
+    "[d":    termbox.KeyArrowLeft,
+}
+
+// keyDecoder turns the escape sequences of shifted arrows, which termbox
+// gives as an escape followed by characters, back into arrow keys
+type keyDecoder struct {
+    pending []termbox.Event
+    seq     string
+}
+
+// decode takes the next event from termbox and gives the events it completes.
+// An escape is held until the events after it show whether it starts a
+// shifted arrow.
+func (d *keyDecoder) decode(ev termbox.Event) []termbox.Event {
+    if len(d.pending) > 0 && ev.Type == termbox.EventKey && ev.Ch != 0 {
+        seq := d.seq + string(ev.Ch)
+        if key, ok := shiftArrows[seq]; ok {
+            d.pending = nil
+            d.seq = ""
+            return []termbox.Event{termbox.Event{Type: termbox.EventKey, Key: key, Mod: modShift}}
+        }
+        for s := range shiftArrows {
+            if strings.HasPrefix(s, seq) {
+                d.pending = append(d.pending, ev)
+                d.seq = seq
+                return nil
+            }
+        }
+    }
+
+    // Not a shifted arrow after all
+    events := d.pending
+    d.pending = nil
+    d.seq = ""
+    if ev.Type == termbox.EventKey && ev.Key == termbox.KeyEsc {
+        d.pending = []termbox.Event{ev}
+        return events
+    }
+    return append(events, ev)
+}
+
+// selection is the corner of a selection it was started from. The editor's
+// instrument and tick are the opposite corner.
+type selection struct {
+    field field
+    tick  int
+}
+
+// clip is a copied block of notes. Ticks and lanes count from the top left of
+// the block.
+type clip struct {
+    ticks int
+    lanes int
+    notes []clipNote
+}
+
+// clipNote is one instrument of one tick of a clip
+type clipNote struct {
+    tick         int
+    lane         int
+    value        int
+    velocity     int
+    articulation Articulation
+}
+
+// lane gives the row of an instrument in the grid, or -1 for a field that is
+// not an instrument
+func lane(f field) int {
+    for i, inst := range insts {
+        if inst == f {
+            return i
+        }
+    }
+    return -1
+}
+
+// selected gives the first and last rows and ticks of the selection
+func (state state) selected() (int, int, int, int) {
+    top, bottom := lane(state.selection.field), lane(state.field)
+    if top > bottom {
+        top, bottom = bottom, top
+    }
+    first, last := state.selection.tick, state.activeTick
+    if first > last {
+        first, last = last, first
+    }
+    return top, bottom, first, last
+}
+
+// isSelected reports whether the cell of an instrument on a tick is selected
+func (state state) isSelected(f field, tick int) bool {
+    if state.selection == nil {
+        return false
+    }
+    top, bottom, first, last := state.selected()
+    l := lane(f)
+    return l >= top && l <= bottom && tick >= first && tick <= last
+}
+
+// copyBlock copies the notes of a block of rows and ticks as they play, so
+// an instrument past its loop point copies the notes it repeats
+func (state state) copyBlock(top, bottom, first, last int) clip {
+    c := clip{ticks: last - first + 1, lanes: bottom - top + 1}
+    for tick := first; tick <= last; tick++ {
+        for l := top; l <= bottom; l++ {
+            f := insts[l]
+            b := state.on(laneTick(state.lanes(), f, tick))
+            if b == nil || b.value(f) == 0 {
+                continue
+            }
+            c.notes = append(c.notes, clipNote{
+                tick:         tick - first,
+                lane:         l - top,
+                value:        b.value(f),
+                velocity:     b.velocity(f),
+                articulation: b.articulation(f),
+            })
+        }
+    }
+    return c
+}
+
+// clearBlock silences the instruments of a block of rows and ticks
+func (state *state) clearBlock(top, bottom, first, last int) {
+    for tick := first; tick <= last; tick++ {
+        for l := top; l <= bottom; l++ {
+            state.setNote(insts[l], tick, clipNote{})
+        }
+    }
+}
+
+// paste writes a clip with its top left on the given row and tick, replacing
+// the notes under it. Rows past the grid are left out.
+func (state *state) paste(c clip, top, first int) {
+    bottom := top + c.lanes - 1
+    if bottom >= len(insts) {
+        bottom = len(insts) - 1
+    }
+    state.clearBlock(top, bottom, first, first+c.ticks-1)
+
+    for _, n := range c.notes {
+        l := top + n.lane
+        if l >= len(insts) {
+            continue
+        }
+        state.setNote(insts[l], first+n.tick, n)
+    }
+}
+
+// setNote writes the value, velocity and articulation of a note to an
+// instrument on a tick. Past its loop point an instrument writes the tick it
+// repeats, as editing it by hand does.
+func (state *state) setNote(f field, tick int, n clipNote) {
+    tick = laneTick(state.lanes(), f, tick)
+    b := state.on(tick)
+    if b == nil {
+        if n.value == 0 {
+            return
+        }
+        b = &Beat{Tick: tick}
+    }
+    b.set(f, n.value)
+    b.setVelocity(f, n.velocity)
+    b.setArticulation(f, n.articulation)
+    state.update(b)
+}
+
+// moveSelection moves the selection and the editor along by ticks
+func (state *state) moveSelection(ticks int) {
+    state.selection.tick += ticks
+    state.activeTick += ticks
+    state.scroll()
+}
+
+// selecting handles the keys of selection mode, which is started with v or
+// a shifted arrow on an instrument. It reports whether it took the key.
+func (state *state) selecting(ev *termbox.Event) bool {
+    if lane(state.field) < 0 {
+        return false
+    }
+
+    arrow := ev.Key == termbox.KeyArrowLeft || ev.Key == termbox.KeyArrowRight || ev.Key == termbox.KeyArrowUp || ev.Key == termbox.KeyArrowDown
+    if state.selection == nil {
+        switch {
+        case ev.Ch == 'v', arrow && ev.Mod&modShift != 0:
+            state.selection = &selection{field: state.field, tick: state.activeTick}
+        case ev.Key == termbox.KeyCtrlV && state.clip != nil:
+            state.paste(*state.clip, lane(state.field), state.activeTick)
+            return true
+        default:
+            return false
+        }
+        if !arrow {
+            return true
+        }
+    }
+
+    top, bottom, first, last := state.selected()
+    switch {
+    case arrow:
+        l := lane(state.field)
+        switch ev.Key {
+        case termbox.KeyArrowLeft:
+            if state.activeTick > 1 {
+                state.activeTick--
+            }
+        case termbox.KeyArrowRight:
+            state.activeTick++
+        case termbox.KeyArrowUp:
+            if l > 0 {
+                state.field = insts[l-1]
+            }
+        case termbox.KeyArrowDown:
+            if l < len(insts)-1 {
+                state.field = insts[l+1]
+            }
+        }
+        state.scroll()
+        return true
+    case ev.Key == termbox.KeyCtrlC:
+        c := state.copyBlock(top, bottom, first, last)
+        state.clip = &c
+    case ev.Key == termbox.KeyCtrlX:
+        c := state.copyBlock(top, bottom, first, last)
+        state.clip = &c
+        state.clearBlock(top, bottom, first, last)
+    case ev.Key == termbox.KeyCtrlV:
+        if state.clip != nil {
+            state.paste(*state.clip, top, first)
+        }
+    case ev.Key == termbox.KeyDelete || ev.Key == termbox.KeyBackspace || ev.Key == termbox.KeyBackspace2:
+        state.clearBlock(top, bottom, first, last)
+    case ev.Ch == 'd':
+        // The copy lands on the next bar, or as many bars on as the
+        // selection covers, and is selected for the next copy
+        bar := state.song.TicksPerBar()
+        by := (last - first + bar) / bar * bar
+        state.paste(state.copyBlock(top, bottom, first, last), top, first+by)
+        state.moveSelection(by)
+        return true
+    case ev.Ch == '<' || ev.Ch == ',':
+        if first > 1 {
+            c := state.copyBlock(top, bottom, first, last)
+            state.clearBlock(top, bottom, first, last)
+            state.paste(c, top, first-1)
+            state.moveSelection(-1)
+        }
+        return true
+    case ev.Ch == '>' || ev.Ch == '.':
+        c := state.copyBlock(top, bottom, first, last)
+        state.clearBlock(top, bottom, first, last)
+        state.paste(c, top, first+1)
+        state.moveSelection(1)
+        return true
+    case ev.Ch == 'v':
+    default:
+        // Any other key leaves selection mode and goes on as usual
+        state.selection = nil
+        return false
+    }
+    state.selection = nil
+    return true
+}
@@ -0,0 +1,273 @@
+package beats
+
+import (
+    "strconv"
+    "testing"
+
+    "github.com/google/go-cmp/cmp"
+    "github.com/nsf/termbox-go"
+)
+
+// editing gives the editor on a song of 8 ticks, two bars of 4/4, with the
+// given beats, on the bass drum of the first tick
+func editing(t *testing.T, beats []Beat) *state {
+    song, err := NewSong("test", 120, beats)
+    if err != nil {
+        t.Fatal(err)
+    }
+    song.Length = 8
+    return &state{
+        firstTick:  1,
+        activeTick: 1,
+        song:       *song,
+        field:      bassDrumField,
+        pattern:    -1,
+        layout:     newLayout(80, 24),
+    }
+}
+
+// row gives the values an instrument has on the ticks of the pattern being
+// edited, as written rather than as played, with . for silence
+func row(state *state, f field) string {
+    s := ""
+    for tick := 1; tick <= 8; tick++ {
+        v := 0
+        if b := state.on(tick); b != nil {
+            v = b.value(f)
+        }
+        if v == 0 {
+            s += "."
+        } else {
+            s += strconv.Itoa(v)
+        }
+    }
+    return s
+}
+
+// press sends keys to the editor as the create loop does
+func press(state *state, evs ...termbox.Event) {
+    for _, ev := range evs {
+        ev.Type = termbox.EventKey
+        dispatch(state, &ev)
+    }
+}
+
+var (
+    shiftRight = termbox.Event{Key: termbox.KeyArrowRight, Mod: modShift}
+    shiftUp    = termbox.Event{Key: termbox.KeyArrowUp, Mod: modShift}
+    right      = termbox.Event{Key: termbox.KeyArrowRight}
+    copyKey    = termbox.Event{Key: termbox.KeyCtrlC}
+    cutKey     = termbox.Event{Key: termbox.KeyCtrlX}
+    pasteKey   = termbox.Event{Key: termbox.KeyCtrlV}
+    deleteKey  = termbox.Event{Key: termbox.KeyDelete}
+)
+
+// groove is a bass drum on 1 and 3 with a soft first hit and a snare on 2
+func groove() []Beat {
+    return []Beat{
+        Beat{Tick: 1, BassDrum: 1, BassDrumVelocity: 40},
+        Beat{Tick: 2, SnareDrum: 1},
+        Beat{Tick: 3, BassDrum: 1},
+    }
+}
+
+// TestSelectionCopyPaste verifies that a block copied with its velocities is
+// pasted with its top left on the editor, replacing the notes under it
+func TestSelectionCopyPaste(t *testing.T) {
+    state := editing(t, append(groove(), Beat{Tick: 7, SnareDrum: 1}))
+
+    // Select the snare and bass drum over the first 3 ticks
+    press(state, shiftRight, shiftRight, shiftUp, copyKey)
+    if state.selection != nil {
+        t.Fatal("Expected copying to leave selection mode")
+    }
+    if state.clip == nil || state.clip.ticks != 3 || state.clip.lanes != 2 {
+        t.Fatalf("Expected a clip of 3 ticks and 2 lanes but got %+v", state.clip)
+    }
+
+    press(state, right, right, pasteKey)
+    if got := row(state, bassDrumField); got != "1.1.1.1." {
+        t.Errorf("Expected bass drum 1.1.1.1. but got %s", got)
+    }
+    if got := row(state, snareDrumField); got != ".1...1.." {
+        t.Errorf("Expected snare drum .1...1.. but got %s", got)
+    }
+    if v := state.on(5).velocity(bassDrumField); v != 40 {
+        t.Errorf("Expected the pasted bass drum velocity to be 40 but got %d", v)
+    }
+}
+
+// TestSelectionCut verifies that cutting copies a block and silences it
+func TestSelectionCut(t *testing.T) {
+    state := editing(t, groove())
+    state.field = snareDrumField
+
+    press(state, shiftRight, termbox.Event{Key: termbox.KeyArrowDown, Mod: modShift}, cutKey)
+    if got := row(state, bassDrumField); got != "..1....." {
+        t.Errorf("Expected bass drum ..1..... but got %s", got)
+    }
+    if got := row(state, snareDrumField); got != "........" {
+        t.Errorf("Expected snare drum ........ but got %s", got)
+    }
+
+    want := &clip{ticks: 2, lanes: 2, notes: []clipNote{
+        clipNote{tick: 0, lane: 1, value: 1, velocity: 40},
+        clipNote{tick: 1, lane: 0, value: 1},
+    }}
+    if diff := cmp.Diff(want, state.clip, cmp.AllowUnexported(clip{}, clipNote{})); diff != "" {
+        t.Errorf("Clip mismatch (-want +got):\n%s", diff)
+    }
+}
+
+// TestSelectionClear verifies that delete silences a block along with its
+// velocities and leaves the rest alone
+func TestSelectionClear(t *testing.T) {
+    state := editing(t, groove())
+
+    press(state, termbox.Event{Ch: 'v'}, shiftRight, deleteKey)
+    if got := row(state, bassDrumField); got != "..1....." {
+        t.Errorf("Expected bass drum ..1..... but got %s", got)
+    }
+    if got := row(state, snareDrumField); got != ".1......" {
+        t.Errorf("Expected snare drum .1...... but got %s", got)
+    }
+    if b := state.on(1); b != nil && b.velocity(bassDrumField) != 0 {
+        t.Errorf("Expected the cleared velocity to be 0 but got %d", b.velocity(bassDrumField))
+    }
+}
+
+// TestSelectionShift verifies that < and > move a block a tick at a time,
+// taking the selection along, and that a block never moves before tick 1
+func TestSelectionShift(t *testing.T) {
+    state := editing(t, groove())
+
+    press(state, shiftRight, shiftRight, termbox.Event{Ch: '>'}, termbox.Event{Ch: '>'})
+    if got := row(state, bassDrumField); got != "..1.1..." {
+        t.Errorf("Expected bass drum ..1.1... but got %s", got)
+    }
+    if state.selection == nil || state.selection.tick != 3 || state.activeTick != 5 {
+        t.Fatalf("Expected the selection to move to ticks 3 to 5 but got %+v to %d", state.selection, state.activeTick)
+    }
+
+    press(state, termbox.Event{Ch: '<'}, termbox.Event{Ch: '<'}, termbox.Event{Ch: '<'})
+    if got := row(state, bassDrumField); got != "1.1....." {
+        t.Errorf("Expected bass drum 1.1..... but got %s", got)
+    }
+    if state.selection.tick != 1 || state.activeTick != 3 {
+        t.Errorf("Expected the selection to stop at ticks 1 to 3 but got %d to %d", state.selection.tick, state.activeTick)
+    }
+}
+
+// TestSelectionDuplicate verifies that d copies a block onto the next bar and
+// selects the copy
+func TestSelectionDuplicate(t *testing.T) {
+    state := editing(t, groove())
+
+    press(state, shiftRight, shiftRight, termbox.Event{Ch: 'd'})
+    if got := row(state, bassDrumField); got != "1.1.1.1." {
+        t.Errorf("Expected bass drum 1.1.1.1. but got %s", got)
+    }
+    if got := row(state, snareDrumField); got != ".1......" {
+        t.Errorf("Expected only the bass drum to be copied but got snare drum %s", got)
+    }
+    if state.selection == nil || state.selection.tick != 5 || state.activeTick != 7 {
+        t.Errorf("Expected the copy on ticks 5 to 7 to be selected but got %+v to %d", state.selection, state.activeTick)
+    }
+
+    // A copy past the end of the pattern grows it by a bar
+    press(state, termbox.Event{Ch: 'd'})
+    if state.song.Length != 12 {
+        t.Errorf("Expected the pattern to grow to 12 ticks but got %d", state.song.Length)
+    }
+}
+
+// TestSelectionLanes verifies that past its loop point an instrument copies,
+// clears and pastes the ticks it repeats, as they play
+func TestSelectionLanes(t *testing.T) {
+    state := editing(t, []Beat{
+        Beat{Tick: 1, HiHat: 1},
+        Beat{Tick: 2, HiHat: 2},
+    })
+    state.song.Lanes = map[string]int{"hh": 3}
+    state.field = hiHatField
+
+    // Ticks 4 to 6 play ticks 1 to 3 of the lane
+    c := state.copyBlock(lane(hiHatField), lane(hiHatField), 4, 6)
+    want := clip{ticks: 3, lanes: 1, notes: []clipNote{
+        clipNote{tick: 0, lane: 0, value: 1},
+        clipNote{tick: 1, lane: 0, value: 2},
+    }}
+    if diff := cmp.Diff(want, c, cmp.AllowUnexported(clip{}, clipNote{})); diff != "" {
+        t.Errorf("Clip mismatch (-want +got):\n%s", diff)
+    }
+
+    // Pasting on tick 8 writes tick 2 and wraps onto tick 3
+    state.paste(clip{ticks: 2, lanes: 1, notes: []clipNote{
+        clipNote{tick: 0, lane: 0, value: 2},
+        clipNote{tick: 1, lane: 0, value: 1},
+    }}, lane(hiHatField), 8)
+    if got := row(state, hiHatField); got != "121....." {
+        t.Errorf("Expected hi-hat 121..... but got %s", got)
+    }
+
+    state.clearBlock(lane(hiHatField), lane(hiHatField), 7, 7)
+    if got := row(state, hiHatField); got != ".21....." {
+        t.Errorf("Expected hi-hat .21..... but got %s", got)
+    }
+}
+
+// TestKeyDecoder verifies that the escape sequences of shifted arrows become
+// arrow keys with shift held, and other escapes pass through as they came
+func TestKeyDecoder(t *testing.T) {
+    esc := termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc}
+    ch := func(c rune) termbox.Event {
+        return termbox.Event{Type: termbox.EventKey, Ch: c}
+    }
+
+    tests := []struct {
+        name string
+        in   []termbox.Event
+        want []termbox.Event
+    }{
+        {
+            name: "xterm shift right",
+            in:   []termbox.Event{esc, ch('['), ch('1'), ch(';'), ch('2'), ch('C')},
+            want: []termbox.Event{termbox.Event{Type: termbox.EventKey, Key: termbox.KeyArrowRight, Mod: modShift}},
+        },
+        {
+            name: "rxvt shift up",
+            in:   []termbox.Event{esc, ch('['), ch('a')},
+            want: []termbox.Event{termbox.Event{Type: termbox.EventKey, Key: termbox.KeyArrowUp, Mod: modShift}},
+        },
+        {
+            name: "escape then a key",
+            in:   []termbox.Event{esc, ch('x')},
+            want: []termbox.Event{esc, ch('x')},
+        },
+        {
+            name: "sequence that is not an arrow",
+            in:   []termbox.Event{esc, ch('['), ch('1'), ch('x')},
+            want: []termbox.Event{esc, ch('['), ch('1'), ch('x')},
+        },
+        {
+            name: "escape held for the next escape",
+            in:   []termbox.Event{esc, esc},
+            want: []termbox.Event{esc},
+        },
+        {
+            name: "plain keys",
+            in:   []termbox.Event{ch('v'), termbox.Event{Type: termbox.EventKey, Key: termbox.KeyArrowLeft}},
+            want: []termbox.Event{ch('v'), termbox.Event{Type: termbox.EventKey, Key: termbox.KeyArrowLeft}},
+        },
+    }
+    for _, test := range tests {
+        var d keyDecoder
+        var got []termbox.Event
+        for _, ev := range test.in {
+            got = append(got, d.decode(ev)...)
+        }
+        if diff := cmp.Diff(test.want, got); diff != "" {
+            t.Errorf("%s mismatch (-want +got):\n%s", test.name, diff)
+        }
+    }
+}
@@ -1,10 +1,13 @@
 package beats
 
 import (
+    "bytes"
+    "context"
     "encoding/json"
     "errors"
+    "fmt"
     "io"
-    "sort"
+    "io/ioutil"
     "time"
 
     "github.com/benbjohnson/clock"
@@ -12,72 +15,189 @@ import (
 
 // Song is a whole song including its name, tempo and all the beats. The beats
 // array is sparse; each beat covers its own tick in the rhythm. Beats must be
-// sorted.
+// sorted. Length is the number of ticks in the pattern; when it is 0 the
+// pattern ends with the last beat.
+//
+// StepsPerBeat is the number of ticks in each beat of the tempo, such as 4 for
+// sixteenth notes or 3 for triplets. When it is 0 each tick is a whole beat.
+// Signature is the time signature written as "3/4"; when it is empty the song
+// is in 4/4.
+//
+// Swing is the percentage of each pair of ticks taken by the first tick, from
+// 50 for straight time up to 75 for a hard shuffle. Every even tick is delayed
+// to make up the difference. When it is 0 the song plays straight.
+//
+// Tempo is the tempo the song starts at in beats per minute, and may be
+// fractional such as 127.5. Tempos is a tempo map of changes from there, each
+// jumping or ramping to a new tempo on its tick.
+//
+// Lanes gives instruments a loop length of their own, keyed by the code of
+// the instrument such as "hh": 3 for a hi-hat that loops every 3 ticks while
+// the rest of the pattern runs on. Its notes must fall within its lane.
+//
+// Patterns is a bank of named patterns and Chain lists which of them play in
+// which order. A song with a chain plays the chain in place of its own beats,
+// which must then be empty.
+//
+// Version is the version of the file format the song was read from. Parse
+// upgrades older files so parsed songs are always CurrentVersion, and songs
+// are always written as CurrentVersion.
 type Song struct {
-    Name  string `json:"name,omitempty"`
-    Tempo int    `json:"tempo,omitempty"`
-    Beats []Beat `json:"beats"`
+    Version      int            `json:"version,omitempty"`
+    Name         string         `json:"name,omitempty"`
+    Tempo        float64        `json:"tempo,omitempty"`
+    Tempos       []TempoChange  `json:"tempos,omitempty"`
+    StepsPerBeat int            `json:"steps,omitempty"`
+    Signature    string         `json:"signature,omitempty"`
+    Swing        int            `json:"swing,omitempty"`
+    Length       int            `json:"length,omitempty"`
+    Beats        []Beat         `json:"beats,omitempty"`
+    Lanes        map[string]int `json:"lanes,omitempty"`
+    Patterns     []Pattern      `json:"patterns,omitempty"`
+    Chain        []Link         `json:"chain,omitempty"`
 }
 
 // NewSong creates a song while ensuring that the beats of the song are validly
-// numbered. Tick numbers must be greater than 0 and may not repeat.
-func NewSong(name string, tempo int, beats []Beat) (*Song, error) {
-    // Sort the beats in case we were passed bad data
-    sort.Sort(ByTick(beats))
+// numbered. Tick numbers must be greater than 0 and may not repeat. Patterns
+// and a chain can be added to the song afterwards and are checked by Parse.
+// An invalid song gives a *ValidationError listing every problem found.
+func NewSong(name string, tempo float64, beats []Beat) (*Song, error) {
+    song := Song{
+        Version: CurrentVersion,
+        Name:    name,
+        Tempo:   tempo,
+        Beats:   beats,
+    }
+
+    err := song.validate()
+    if err != nil {
+        return nil, err
+    }
+    return &song, nil
+}
+
+// validate sorts the beats of the song and ensures that every field of the
+// song is valid. It gives a *ValidationError listing every problem found.
+func (song *Song) validate() error {
+    var v validator
+    song.check(&v)
+    return v.err()
+}
 
+// check adds a problem to v for every invalid field of the song
+func (song *Song) check(v *validator) {
     // Validate non-empty name
-    if name == "" {
-        return nil, errors.New("Song name should not be empty")
+    if song.Name == "" {
+        v.add(CodeName, "name", "Song name should not be empty")
     }
 
     // Validate positive tempo
-    if !(tempo > 0) {
-        return nil, errors.New("Song tempo should be greater than 0")
+    if !(song.Tempo > 0) {
+        v.add(CodeTempo, "tempo", "Song tempo should be greater than 0")
     }
 
-    // Evaluation note: though the following two for loops could be collapsed
-    // into a single for loop they are intentionally kept separate for clarity.
-    // Validators should be separated and processed independently unless the
-    // performance penalty requires corrective action.
+    // Validate the tempo map
+    checkTempos(v, song.Tempos)
 
-    // Validate no non-positive tick numbers
-    for i := 0; i < len(beats); i++ {
-        if beats[i].Tick <= 0 {
-            return nil, errors.New("Tick number for beat must be greater than 0")
-        }
+    // Validate the beats are validly numbered and covered by the length
+    checkBeats(v, "", song.Beats, song.Length)
+    checkLanes(v, "", song.Beats, song.Lanes)
+
+    // Validate a version of the format this package knows. Songs built in code
+    // have no version until they are written, while files that give a version
+    // of 0 are already rejected by Upgrade.
+    if song.Version < 0 || song.Version > CurrentVersion {
+        v.add(CodeVersion, "version", "Song version %d should be between 1 and %d, or 0 for a song not read from a file", song.Version, CurrentVersion)
+    }
+
+    // Validate a non-negative step resolution
+    if song.StepsPerBeat < 0 {
+        v.add(CodeSteps, "steps", "Song steps per beat should not be negative")
     }
 
-    // Validate that no tick number repeats among the beats
-    tick := 0
-    for i := 0; i < len(beats); i++ {
-        if beats[i].Tick == tick {
-            return nil, errors.New("Tick number for beat may not repeat")
+    // Validate swing between straight and a hard shuffle
+    if song.Swing != 0 && (song.Swing < MinSwing || song.Swing > MaxSwing) {
+        v.add(CodeSwing, "swing", "Song swing should be between %d and %d", MinSwing, MaxSwing)
+    }
+
+    // Validate the time signature
+    if song.Signature != "" {
+        _, _, err := parseSignature(song.Signature)
+        if err != nil {
+            v.add(CodeSignature, "signature", "%v", err)
         }
-        tick = beats[i].Tick
     }
 
-    return &Song{
-        Name:  name,
-        Tempo: tempo,
-        Beats: beats,
-    }, nil
+    // Validate the patterns and the chain that plays them
+    song.checkChain(v)
 }
 
-// Parse parses a song from a Reader
+// Parse parses a song from a Reader. Files of older versions of the format are
+// upgraded to the current version. An invalid song gives a *ValidationError
+// listing every problem found along with where it is in the source.
 func Parse(reader io.Reader) (*Song, error) {
+    return parse(reader, false)
+}
+
+// parse parses a song from a Reader, checking it strictly when strict is set
+func parse(reader io.Reader, strict bool) (*Song, error) {
+    data, err := ioutil.ReadAll(reader)
+    if err != nil {
+        return nil, err
+    }
+
+    var v validator
+    upgraded, _, err := Upgrade(data)
+    if err != nil {
+        v.add(CodeVersion, "version", "%v", err)
+        v.locate(data)
+        return nil, v.err()
+    }
+
     var song Song
-    err := json.NewDecoder(reader).Decode(&song)
+    err = json.NewDecoder(bytes.NewReader(upgraded)).Decode(&song)
+    if err != nil {
+        v.problems = append(v.problems, decodeProblem(data, err))
+        if _, ok := err.(*json.UnmarshalTypeError); !ok {
+            // Nothing more can be read from the file
+            return nil, v.err()
+        }
+    }
+
+    if strict {
+        song.checkStrict(&v, upgraded)
+    }
+    v.merge(song.validate())
+    v.locate(data)
+    err = v.err()
     if err != nil {
         return nil, err
     }
+    return &song, nil
+}
 
-    return NewSong(song.Name, song.Tempo, song.Beats)
+// Ticks gives the number of ticks in one pass of the song. This is the song
+// length when it is set and otherwise runs to the last beat. A song with a
+// chain runs for the whole chain.
+func (song Song) Ticks() int {
+    if len(song.Chain) > 0 {
+        return song.Arrange().Ticks()
+    }
+    return patternTicks(song.Beats, song.Length)
+}
+
+// WriteJSON writes the song to a Writer in the json song format
+func (song Song) WriteJSON(w io.Writer) error {
+    song.Version = CurrentVersion
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "    ")
+    return enc.Encode(song)
 }
 
 // Default constructs a default song. The default is a simple four on the floor
-// implementation.
+// implementation in sixteenth notes.
 func Default() (*Song, error) {
-    return NewSong(
+    song, err := NewSong(
         "four-on-the-floor",
         128,
         []Beat{
@@ -117,51 +237,133 @@ func Default() (*Song, error) {
             },
         },
     )
+    if err != nil {
+        return nil, err
+    }
+
+    song.StepsPerBeat = 4
+    song.Signature = "4/4"
+    return song, nil
 }
 
-// Step is one step of the sequence at a given tick
+// Step is one step of the sequence at a given tick. Loop counts the passes
+// through the pattern from 0. Scheduled is when the step was due to play and
+// Actual is when the player released it.
+//
+// Sub is 0 for the step on the tick itself, whose Beat is the whole beat of
+// the tick. Ratchets strike again within the tick, and each later strike
+// follows as a step of the same tick with Sub counting up from 1 and a Beat of
+// only the instruments struck then. The grace notes of flams come ahead of
+// their tick, as a step of that tick with a Sub of -1 released at the end of
+// the tick before. Consumers that work a tick at a time can skip the steps
+// with a Sub, and find the beat of the tick that follows in Next, which is
+// empty once the song ends.
 type Step struct {
-    Tick int
-    Beat Beat
+    Tick      int
+    Loop      int
+    Sub       int
+    Beat      Beat
+    Next      Beat
+    Scheduled time.Time
+    Actual    time.Time
+}
+
+// Late gives how far behind its schedule the step was released
+func (step Step) Late() time.Duration {
+    return step.Actual.Sub(step.Scheduled)
 }
 
 // Play plays a song. The clock parameter allows you to use a specific clock
-// such as a mock clock for testing.
-func (song Song) Play(clock clock.Clock, out chan Step) {
-    // Time between ticks in the sequence
-    d := song.TickDuration()
-
-    // Make sure the beats are sorted
-    beats := song.Beats
-    sort.Sort(ByTick(beats))
-
-    // Play each beat on a ticker
-    tick := 1
-    i := 0
-    ticker := clock.Ticker(d)
-    for {
-        if i >= len(song.Beats) {
-            break
-        }
+// such as a mock clock for testing. Steps are sent on out strictly in tick
+// order from a single goroutine, and out is closed once the last tick has
+// passed. The pattern plays once unless a loop option is given. By default a
+// slow consumer holds up the steps after it; use the options to choose
+// another policy or to hear about late and dropped steps. Use a Player to
+// control a song while it plays.
+func (song Song) Play(clock clock.Clock, out chan Step, opts ...PlayOption) {
+    player := newPlayer(song, clock, out, opts)
+    player.tickStart = clock.Now()
+    player.run(context.Background())
+}
 
-        if song.Beats[i].Tick == tick {
-            go func(tick int, i int) {
-                out <- Step{tick, song.Beats[i]}
-            }(tick, i)
-            i++
-        } else {
-            go func(tick int) {
-                out <- Step{tick, Beat{Tick: tick}}
-            }(tick)
-        }
+// TickDuration gives the amount of time a tick lasts at the tempo it plays
+// at, before swing
+func (song Song) TickDuration(tick int) time.Duration {
+    return time.Duration(float64(time.Minute) / (song.TempoAt(tick) * float64(song.Steps())))
+}
+
+// Limits of swing. MinSwing is straight time.
+const (
+    MinSwing = 50
+    MaxSwing = 75
+)
+
+// SwingOffset gives how far a tick is delayed from the straight grid by swing.
+// Only even ticks are delayed.
+func (song Song) SwingOffset(tick int) time.Duration {
+    if tick%2 != 0 || song.Swing <= MinSwing {
+        return 0
+    }
+    return song.TickDuration(tick) * 2 * time.Duration(song.Swing-MinSwing) / 100
+}
+
+// StepDuration gives the time from the start of a tick to the start of the
+// next, including swing. The tick after the last tick of the pattern is the
+// first tick of the next pass.
+func (song Song) StepDuration(tick int) time.Duration {
+    next := tick + 1
+    if next > song.Ticks() {
+        next = 1
+    }
+    return song.TickDuration(tick) + song.SwingOffset(next) - song.SwingOffset(tick)
+}
 
-        <-ticker.C
-        tick++
+// Steps gives the number of ticks in each beat
+func (song Song) Steps() int {
+    if song.StepsPerBeat > 0 {
+        return song.StepsPerBeat
+    }
+    return 1
+}
+
+// Meter gives the number of beats in a bar and the note value of each beat
+// from the time signature
+func (song Song) Meter() (int, int) {
+    beats, unit, err := parseSignature(song.Signature)
+    if err != nil {
+        return 4, 4
     }
-    close(out)
+    return beats, unit
 }
 
-// TickDuration gives the amount of time between ticks
-func (song Song) TickDuration() time.Duration {
-    return time.Minute / time.Duration(song.Tempo)
+// TicksPerBar gives the number of ticks in each bar
+func (song Song) TicksPerBar() int {
+    beats, _ := song.Meter()
+    return beats * song.Steps()
+}
+
+// Position gives the bar, the beat within the bar and the step within the beat
+// of a tick, each counting from 1
+func (song Song) Position(tick int) (int, int, int) {
+    steps := song.Steps()
+    beats, _ := song.Meter()
+    t := tick - 1
+    return t/(beats*steps) + 1, t/steps%beats + 1, t%steps + 1
+}
+
+// parseSignature parses a time signature such as "3/4" into its beats per bar
+// and note value
+func parseSignature(signature string) (int, int, error) {
+    var beats, unit int
+    _, err := fmt.Sscanf(signature, "%d/%d", &beats, &unit)
+    if err != nil || fmt.Sprintf("%d/%d", beats, unit) != signature {
+        return 0, 0, fmt.Errorf("Song time signature %q should be written as beats/unit such as 4/4", signature)
+    }
+    if beats <= 0 {
+        return 0, 0, errors.New("Song time signature should have at least 1 beat per bar")
+    }
+    if unit <= 0 || unit&(unit-1) != 0 {
+        return 0, 0, errors.New("Song time signature note value should be a power of 2")
+    }
+    return beats, unit, nil
 }
@@ -36,7 +36,7 @@ func TestPlay(t *testing.T) {
     }()
 
     // Advance to just before first tick, we are prepared for first tick
-    advance(clock, song.TickDuration()/2)
+    advance(clock, song.TickDuration(1)/2)
 
     tick := 1
     // For each beat in the song
@@ -51,7 +51,7 @@ func TestPlay(t *testing.T) {
             } else if !cmp.Equal(step.Beat, beats.Beat{Tick: tick}) {
                 t.Fatalf("Output channel should be empty but got %s\n", step.Beat)
             }
-            advance(clock, song.TickDuration())
+            advance(clock, song.TickDuration(1))
         }
 
         // Verify there's a beat on the output channel
@@ -61,7 +61,7 @@ func TestPlay(t *testing.T) {
         } else if cmp.Equal(step.Beat, beats.Beat{Tick: tick}) {
             t.Fatalf("Output channel should be non-empty but got %d, %s\n", step.Tick, step.Beat)
         }
-        advance(clock, song.TickDuration())
+        advance(clock, song.TickDuration(1))
         tick++
     }
 
@@ -196,7 +196,7 @@ func TestParseAllNotes(t *testing.T) {
     }()
 
     for {
-        advance(clock, song.TickDuration())
+        advance(clock, song.TickDuration(1))
         select {
         case step, ok := <-out:
             t.Log(step)
@@ -225,7 +225,7 @@ func TestParse(t *testing.T) {
     }
 
     if song.Tempo != 188 {
-        t.Errorf("Expected tempo of 188 but got %d", song.Tempo)
+        t.Errorf("Expected tempo of 188 but got %g", song.Tempo)
     }
 
     if len(song.Beats) != 10 {
@@ -249,3 +249,144 @@ func read(out chan beats.Step) (beats.Step, bool) {
         return beats.Step{}, true
     }
 }
+
+// TestParseShortLength verifies we fail to parse when the song length does not
+// cover every beat
+func TestParseShortLength(t *testing.T) {
+    reader, err := os.Open("testdata/short-length.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    _, err = beats.Parse(reader)
+    if err == nil {
+        t.Fatal("Expected an error")
+    }
+}
+
+// TestTickDuration verifies the time between ticks follows the steps per beat
+func TestTickDuration(t *testing.T) {
+    song, err := beats.NewSong("steps", 120, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if d := song.TickDuration(1); d != 500*time.Millisecond {
+        t.Errorf("Expected 500ms per tick but got %s", d)
+    }
+
+    song.StepsPerBeat = 4
+    if d := song.TickDuration(1); d != 125*time.Millisecond {
+        t.Errorf("Expected 125ms per tick but got %s", d)
+    }
+
+    song.StepsPerBeat = 3
+    if d := song.TickDuration(1); d != 500*time.Millisecond/3 {
+        t.Errorf("Expected a third of 500ms per tick but got %s", d)
+    }
+}
+
+// TestPosition verifies ticks are placed in bars and beats by the time
+// signature and steps per beat
+func TestPosition(t *testing.T) {
+    song, err := beats.NewSong("position", 120, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    song.StepsPerBeat = 3
+    song.Signature = "3/4"
+
+    tests := []struct {
+        tick, bar, beat, step int
+    }{
+        {1, 1, 1, 1},
+        {3, 1, 1, 3},
+        {4, 1, 2, 1},
+        {9, 1, 3, 3},
+        {10, 2, 1, 1},
+    }
+    for _, test := range tests {
+        bar, beat, step := song.Position(test.tick)
+        if bar != test.bar || beat != test.beat || step != test.step {
+            t.Errorf("Expected tick %d at %d.%d.%d but got %d.%d.%d", test.tick, test.bar, test.beat, test.step, bar, beat, step)
+        }
+    }
+}
+
+// TestParseBadSignature verifies we fail to parse a song with a malformed time
+// signature
+func TestParseBadSignature(t *testing.T) {
+    reader, err := os.Open("testdata/bad-signature.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    _, err = beats.Parse(reader)
+    if err == nil {
+        t.Fatal("Expected an error")
+    }
+}
+
+// TestSwing verifies that swing delays only the even ticks and that the time
+// between ticks still adds up to the straight time
+func TestSwing(t *testing.T) {
+    song, err := beats.NewSong("swing", 60, []beats.Beat{beats.Beat{Tick: 4, BassDrum: 1}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    song.Swing = 75
+
+    if d := song.SwingOffset(1); d != 0 {
+        t.Errorf("Expected no delay on tick 1 but got %s", d)
+    }
+    if d := song.SwingOffset(2); d != 500*time.Millisecond {
+        t.Errorf("Expected 500ms delay on tick 2 but got %s", d)
+    }
+    if d := song.StepDuration(1); d != 1500*time.Millisecond {
+        t.Errorf("Expected 1.5s for tick 1 but got %s", d)
+    }
+    if d := song.StepDuration(2); d != 500*time.Millisecond {
+        t.Errorf("Expected 500ms for tick 2 but got %s", d)
+    }
+
+    // An odd length pattern starts its next pass straight
+    song.Length = 3
+    if d := song.StepDuration(3); d != time.Second {
+        t.Errorf("Expected 1s for the last tick but got %s", d)
+    }
+}
+
+// TestParseTooMuchSwing verifies we fail to parse a song swung past the limit
+func TestParseTooMuchSwing(t *testing.T) {
+    reader, err := os.Open("testdata/too-much-swing.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    _, err = beats.Parse(reader)
+    if err == nil {
+        t.Fatal("Expected an error")
+    }
+}
+
+// TestParseVelocity verifies that instrument velocities are read and shown
+// with their beat
+func TestParseVelocity(t *testing.T) {
+    reader, err := os.Open("testdata/velocity.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    ghost := song.Beats[2]
+    if ghost.SnareDrumVelocity != 30 {
+        t.Errorf("Expected snare velocity of 30 but got %d", ghost.SnareDrumVelocity)
+    }
+    if s := ghost.String(); s != "snare_1@30" {
+        t.Errorf("Expected ghost note to print as snare_1@30 but got %s", s)
+    }
+}
@@ -0,0 +1,172 @@
+package beats
+
+import (
+    "math"
+    "math/rand"
+)
+
+// Synthesized approximations of the TR-707 voices. Each voice is generated as
+// a one-shot buffer of samples in the range [-1, 1] and mixed by the renderer.
+// Noise is seeded so that renders of the same song are identical.
+
+// synth generates the voice for the given instrument field and value. An
+// inactive value generates no samples.
+func synth(field field, value int, sampleRate int) []float64 {
+    sr := float64(sampleRate)
+
+    switch field {
+    case bassDrumField:
+        switch Bass(value) {
+        case bdOne:
+            return drum(sr, 150, 50, 0.3)
+        case bdTwo:
+            return drum(sr, 120, 42, 0.45)
+        }
+    case snareDrumField:
+        switch Snare(value) {
+        case sdOne:
+            return snare(sr, 185, 0.08, 0.15)
+        case sdTwo:
+            return snare(sr, 225, 0.06, 0.22)
+        }
+    case lowTomField:
+        if Tom(value) == tOn {
+            return drum(sr, 110, 80, 0.3)
+        }
+    case midTomField:
+        if Tom(value) == tOn {
+            return drum(sr, 160, 120, 0.25)
+        }
+    case hiTomField:
+        if Tom(value) == tOn {
+            return drum(sr, 230, 180, 0.2)
+        }
+    case rimCowField:
+        switch RimshotCowbell(value) {
+        case rimshot:
+            return metal(sr, []float64{500, 1700}, 0.015, 0.8)
+        case cowbell:
+            return metal(sr, []float64{540, 800}, 0.12, 0.5)
+        }
+    case hcpTambField:
+        switch HandClapTambourine(value) {
+        case handClap:
+            return clap(sr)
+        case tambourine:
+            return noise(sr, 0.2, 0.9, 0.6)
+        }
+    case hiHatField:
+        switch HiHat(value) {
+        case closed:
+            return noise(sr, 0.04, 0.95, 0.5)
+        case open:
+            return noise(sr, 0.3, 0.95, 0.5)
+        }
+    case cymbalField:
+        switch Cymbal(value) {
+        case crash:
+            return mix(noise(sr, 1.0, 0.85, 0.6), metal(sr, []float64{3150, 4330, 5670}, 0.6, 0.15))
+        case ride:
+            return mix(noise(sr, 0.7, 0.9, 0.3), metal(sr, []float64{2520, 3710, 4960}, 0.8, 0.25))
+        }
+    }
+
+    return nil
+}
+
+// voiceLength is the number of samples needed for a voice with the given
+// decay time constant to fall below audible levels.
+func voiceLength(sr, decay float64) int {
+    return int(sr * decay * 7)
+}
+
+// drum is a sine wave sweeping from the start to the end frequency with an
+// exponential decay, used for the bass drums and toms.
+func drum(sr, start, end, decay float64) []float64 {
+    out := make([]float64, voiceLength(sr, decay))
+    phase := 0.0
+    for i := range out {
+        t := float64(i) / sr
+        freq := end + (start-end)*math.Exp(-t/0.04)
+        phase += 2 * math.Pi * freq / sr
+        out[i] = math.Sin(phase) * math.Exp(-t/decay)
+    }
+    return out
+}
+
+// snare is a short tone layered under a longer burst of filtered noise
+func snare(sr, freq, toneDecay, noiseDecay float64) []float64 {
+    out := noise(sr, noiseDecay, 0.6, 0.7)
+    for i := range out {
+        t := float64(i) / sr
+        out[i] += 0.6 * math.Sin(2*math.Pi*freq*t) * math.Exp(-t/toneDecay)
+    }
+    return out
+}
+
+// metal is a set of detuned square waves with an exponential decay, used for
+// the rimshot, cowbell and the metallic part of the cymbals.
+func metal(sr float64, freqs []float64, decay, level float64) []float64 {
+    out := make([]float64, voiceLength(sr, decay))
+    for i := range out {
+        t := float64(i) / sr
+        s := 0.0
+        for _, f := range freqs {
+            if math.Sin(2*math.Pi*f*t) >= 0 {
+                s++
+            } else {
+                s--
+            }
+        }
+        out[i] = level * s / float64(len(freqs)) * math.Exp(-t/decay)
+    }
+    return out
+}
+
+// noise is high-passed white noise with an exponential decay. The filter
+// coefficient controls how bright the noise is; values closer to 1 remove
+// more of the low end.
+func noise(sr, decay, filter, level float64) []float64 {
+    rnd := rand.New(rand.NewSource(707))
+    out := make([]float64, voiceLength(sr, decay))
+    prevIn, prevOut := 0.0, 0.0
+    for i := range out {
+        t := float64(i) / sr
+        in := rnd.Float64()*2 - 1
+        prevOut = filter * (prevOut + in - prevIn)
+        prevIn = in
+        out[i] = level * prevOut * math.Exp(-t/decay)
+    }
+    return out
+}
+
+// clap is noise retriggered a few times in quick succession followed by a
+// longer tail, mimicking several hands clapping at once.
+func clap(sr float64) []float64 {
+    out := noise(sr, 0.12, 0.8, 0.7)
+    burst := int(sr * 0.01)
+    for i := range out {
+        t := float64(i) / sr
+        if i < burst*3 {
+            out[i] *= math.Exp(-float64(i%burst)/sr/0.003) / math.Exp(-t/0.12)
+        }
+    }
+    return out
+}
+
+// mix sums the given voices into a single voice
+func mix(voices ...[]float64) []float64 {
+    n := 0
+    for _, v := range voices {
+        if len(v) > n {
+            n = len(v)
+        }
+    }
+    out := make([]float64, n)
+    for _, v := range voices {
+        for i, s := range v {
+            out[i] += s
+        }
+    }
+    return out
+}
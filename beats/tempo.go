@@ -0,0 +1,122 @@
+package beats
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// Ramp is how the tempo of a song gets to the tempo of a tempo change
+type Ramp string
+
+const (
+    // RampJump changes to the new tempo on the tick of the change. It is the
+    // ramp of a change that does not give one.
+    RampJump Ramp = "jump"
+    // RampLinear moves the tempo evenly, tick by tick, from the change before
+    // so it reaches the new tempo on the tick of the change
+    RampLinear Ramp = "linear"
+)
+
+// TempoChange is one entry of the tempo map of a song. From Tick on the song
+// plays at BPM beats per minute, and Ramp sets how it gets there. Ticks count
+// through the whole chain of a song with one.
+type TempoChange struct {
+    Tick int     `json:"tick"`
+    BPM  float64 `json:"bpm"`
+    Ramp Ramp    `json:"ramp,omitempty"`
+}
+
+// TempoAt gives the tempo in beats per minute that a tick plays at. The song
+// starts at its Tempo and follows its tempo map from there.
+func (song Song) TempoAt(tick int) float64 {
+    from := TempoChange{Tick: 1, BPM: song.Tempo}
+    var to *TempoChange
+    for i, change := range song.Tempos {
+        if change.Tick <= tick {
+            if change.Tick >= from.Tick {
+                from = change
+            }
+        } else if to == nil || change.Tick < to.Tick {
+            to = &song.Tempos[i]
+        }
+    }
+
+    if to != nil && to.Ramp == RampLinear {
+        // The tick is on the way to the next change
+        span := float64(to.Tick - from.Tick)
+        return from.BPM + (to.BPM-from.BPM)*float64(tick-from.Tick)/span
+    }
+    return from.BPM
+}
+
+// checkTempos adds a problem to v for every invalid entry of a tempo map
+func checkTempos(v *validator, tempos []TempoChange) {
+    seen := map[int]bool{}
+    for i, change := range tempos {
+        path := fmt.Sprintf("tempos[%d]", i)
+        if change.Tick <= 0 {
+            v.add(CodeTick, path+".tick", "Tempo change tick should be greater than 0")
+        } else if seen[change.Tick] {
+            v.add(CodeTickRepeat, path+".tick", "Tempo change tick %d should not repeat", change.Tick)
+        }
+        seen[change.Tick] = true
+
+        if !(change.BPM > 0) {
+            v.add(CodeTempo, path+".bpm", "Tempo change bpm should be greater than 0")
+        }
+        switch change.Ramp {
+        case "", RampJump, RampLinear:
+        default:
+            v.add(CodeRamp, path+".ramp", "Tempo change ramp %s should be %s or %s", change.Ramp, RampJump, RampLinear)
+        }
+    }
+}
+
+// formatTempo writes a tempo with as many decimals as it needs, such as 120
+// or 127.5
+func formatTempo(bpm float64) string {
+    return strconv.FormatFloat(bpm, 'f', -1, 64)
+}
+
+// parseTempos parses a tempo map written as tick=bpm entries separated by
+// commas, each optionally followed by its ramp such as "17=140 linear, 33=90"
+func parseTempos(value string) ([]TempoChange, error) {
+    var tempos []TempoChange
+    for _, entry := range strings.Split(value, ",") {
+        fields := strings.Fields(entry)
+        if len(fields) < 1 || len(fields) > 2 {
+            return nil, fmt.Errorf("Tempo changes should be a tick=bpm and an optional ramp")
+        }
+        parts := strings.Split(fields[0], "=")
+        if len(parts) != 2 {
+            return nil, fmt.Errorf("Tempo changes should be written as tick=bpm")
+        }
+        tick, err := strconv.Atoi(parts[0])
+        if err != nil {
+            return nil, err
+        }
+        bpm, err := strconv.ParseFloat(parts[1], 64)
+        if err != nil || math.IsNaN(bpm) || math.IsInf(bpm, 0) {
+            return nil, fmt.Errorf("Bad bpm %s", parts[1])
+        }
+
+        change := TempoChange{Tick: tick, BPM: bpm}
+        if len(fields) == 2 {
+            change.Ramp = Ramp(strings.ToLower(fields[1]))
+        }
+        tempos = append(tempos, change)
+    }
+    return tempos, nil
+}
+
+// String gives the tempo change as written in a grid, such as "17=140
+// linear"
+func (change TempoChange) String() string {
+    s := fmt.Sprintf("%d=%s", change.Tick, formatTempo(change.BPM))
+    if change.Ramp != "" && change.Ramp != RampJump {
+        s = fmt.Sprintf("%s %s", s, change.Ramp)
+    }
+    return s
+}
@@ -0,0 +1,140 @@
+package beats_test
+
+import (
+    "bytes"
+    "context"
+    "log"
+    "os"
+    "testing"
+    "time"
+
+    "github.com/benbjohnson/clock"
+    "github.com/cody-s-lee/beats/beats"
+    "github.com/google/go-cmp/cmp"
+)
+
+// TestTempoAt verifies that the tempo map jumps and ramps between its
+// changes
+func TestTempoAt(t *testing.T) {
+    reader, err := os.Open("testdata/ramp.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        tick int
+        bpm  float64
+    }{
+        {1, 127.5},
+        {5, 127.5},
+        {6, 130.625},
+        {7, 133.75},
+        {9, 140},
+        {12, 140},
+        {13, 90},
+        {16, 90},
+    }
+    for _, test := range tests {
+        if bpm := song.TempoAt(test.tick); bpm != test.bpm {
+            t.Errorf("Expected tick %d at %g bpm but got %g", test.tick, test.bpm, bpm)
+        }
+    }
+
+    if d := song.TickDuration(13); d != 666666666*time.Nanosecond {
+        t.Errorf("Expected two thirds of a second per tick at 90 bpm but got %s", d)
+    }
+}
+
+// TestParseBadRamp verifies that a tempo change must have a known ramp
+func TestParseBadRamp(t *testing.T) {
+    song := beats.Song{
+        Name:   "ramp",
+        Tempo:  120,
+        Tempos: []beats.TempoChange{beats.TempoChange{Tick: 5, BPM: 90, Ramp: "curve"}},
+    }
+    var b bytes.Buffer
+    err := song.WriteJSON(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    _, err = beats.Parse(&b)
+    verr, ok := err.(*beats.ValidationError)
+    if !ok || len(verr.Problems) != 1 || verr.Problems[0].Code != beats.CodeRamp {
+        t.Fatalf("Expected a ramp problem but got %v", err)
+    }
+    if path := verr.Problems[0].Path; path != "tempos[0].ramp" {
+        t.Errorf("Expected the problem at tempos[0].ramp but got %s", path)
+    }
+}
+
+// TestPlayerTempoChange verifies that ticks after a tempo change play at the
+// new tempo
+func TestPlayerTempoChange(t *testing.T) {
+    song := counting(t, 4)
+    song.Tempos = []beats.TempoChange{beats.TempoChange{Tick: 3, BPM: 120}}
+    clock := clock.NewMock()
+    player := beats.NewPlayer(song, clock)
+    err := player.Start(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer player.Stop()
+
+    var steps []beats.Step
+    for tick := 1; tick <= 4; tick++ {
+        steps = append(steps, expectTick(t, player, clock, tick))
+    }
+
+    want := []time.Duration{time.Second, time.Second, 500 * time.Millisecond}
+    for i, w := range want {
+        if got := steps[i+1].Scheduled.Sub(steps[i].Scheduled); got != w {
+            t.Errorf("Expected %s between ticks %d and %d but got %s", w, i+1, i+2, got)
+        }
+    }
+}
+
+// TestTempoRoundTrip verifies that a tempo map survives a grid and a MIDI
+// file of the same resolution
+func TestTempoRoundTrip(t *testing.T) {
+    reader, err := os.Open("testdata/ramp.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    song, err := beats.Parse(reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var b bytes.Buffer
+    err = song.WriteGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+    got, err := beats.ParseGrid(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if diff := cmp.Diff(song, got); diff != "" {
+        t.Errorf("Grid round trip mismatch (-want +got):\n%s", diff)
+    }
+
+    b.Reset()
+    err = song.WriteSMF(&b)
+    if err != nil {
+        t.Fatal(err)
+    }
+    imported, _, err := beats.ReadSMF(&b, beats.ImportOptions{StepsPerBeat: song.Steps()})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for tick := 1; tick <= song.Ticks(); tick++ {
+        if want, got := song.TempoAt(tick), imported.TempoAt(tick); got < want-0.01 || got > want+0.01 {
+            t.Errorf("Expected tick %d at %g bpm after MIDI but got %g", tick, want, got)
+        }
+    }
+}
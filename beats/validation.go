@@ -0,0 +1,292 @@
+package beats
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// Code identifies the kind of problem found with a song. Codes are stable so
+// tools can match on them.
+type Code string
+
+const (
+    // CodeSyntax is a song file that cannot be read
+    CodeSyntax Code = "syntax"
+    // CodeType is a value of the wrong type, such as a string for the tempo
+    CodeType Code = "type"
+    // CodeVersion is a version of the format this package does not know
+    CodeVersion Code = "version-unsupported"
+    // CodeName is an empty song name
+    CodeName Code = "name-empty"
+    // CodeTempo is a song or tempo change tempo that is not positive
+    CodeTempo Code = "tempo-not-positive"
+    // CodeSteps is a negative number of steps per beat
+    CodeSteps Code = "steps-negative"
+    // CodeSwing is swing outside MinSwing to MaxSwing
+    CodeSwing Code = "swing-range"
+    // CodeSignature is a time signature that cannot be used
+    CodeSignature Code = "signature-invalid"
+    // CodeRamp is a tempo change with a ramp this package does not know
+    CodeRamp Code = "ramp-unknown"
+    // CodeTick is a beat or tempo change tick that is not positive
+    CodeTick Code = "tick-not-positive"
+    // CodeTickRepeat is a beat or tempo change on the same tick as an earlier
+    // one
+    CodeTickRepeat Code = "tick-repeat"
+    // CodeLength is a negative length
+    CodeLength Code = "length-negative"
+    // CodeLengthShort is a length that does not cover every beat
+    CodeLengthShort Code = "length-short"
+    // CodeLane is a lane length for something that is not an instrument
+    CodeLane Code = "lane-unknown"
+    // CodeLaneLength is a lane length that is not positive
+    CodeLaneLength Code = "lane-length-not-positive"
+    // CodeLaneShort is a lane length that does not cover the notes of its
+    // instrument
+    CodeLaneShort Code = "lane-short"
+    // CodePatternName is an empty pattern name
+    CodePatternName Code = "pattern-name-empty"
+    // CodePatternRepeat is a pattern with the name of an earlier pattern
+    CodePatternRepeat Code = "pattern-name-repeat"
+    // CodePatternEmpty is a chained pattern with no beats or length
+    CodePatternEmpty Code = "pattern-empty"
+    // CodeChainBeats is a song with a chain that has beats or lanes of its own
+    CodeChainBeats Code = "chain-song-beats"
+    // CodeChainPattern is a chain entry for a pattern the song does not have
+    CodeChainPattern Code = "chain-unknown-pattern"
+    // CodeChainRepeat is a chain entry with a negative repeat
+    CodeChainRepeat Code = "chain-repeat-negative"
+    // CodeUnknownField is a field the song format does not have, reported by
+    // strict parsing
+    CodeUnknownField Code = "unknown-field"
+    // CodeValue is an instrument value out of range, reported by strict
+    // parsing
+    CodeValue Code = "value-range"
+    // CodeSilent is a velocity or articulation of an instrument that is silent
+    // on its tick, reported by strict parsing
+    CodeSilent Code = "value-silent"
+    // CodeGridHeader is a grid header line that cannot be used
+    CodeGridHeader Code = "grid-header"
+    // CodeGridInstrument is a grid line for an unknown or repeated instrument
+    CodeGridInstrument Code = "grid-instrument"
+    // CodeGridStep is a grid step that is not a value of its instrument
+    CodeGridStep Code = "grid-step"
+)
+
+// Problem is one thing wrong with a song. Path is the JSON path of the value
+// at fault, such as beats[3].tick. Line and Column give its place in the
+// source file, starting from 1, and are 0 when it is not known.
+type Problem struct {
+    Code    Code
+    Path    string
+    Line    int
+    Column  int
+    Message string
+}
+
+func (p Problem) String() string {
+    s := ""
+    if p.Line > 0 {
+        s = fmt.Sprintf("%d:%d: ", p.Line, p.Column)
+    }
+    if p.Path != "" {
+        s = fmt.Sprintf("%s%s: ", s, p.Path)
+    }
+    return fmt.Sprintf("%s%s (%s)", s, p.Message, p.Code)
+}
+
+// ValidationError lists every problem found with a song
+type ValidationError struct {
+    Problems []Problem
+}
+
+func (err *ValidationError) Error() string {
+    lines := make([]string, len(err.Problems))
+    for i, p := range err.Problems {
+        lines[i] = p.String()
+    }
+    return strings.Join(lines, "\n")
+}
+
+// validator collects the problems found with a song
+type validator struct {
+    problems []Problem
+}
+
+func (v *validator) add(code Code, path string, format string, args ...interface{}) {
+    v.problems = append(v.problems, Problem{
+        Code:    code,
+        Path:    path,
+        Message: fmt.Sprintf(format, args...),
+    })
+}
+
+// addLine adds a problem found on a line of a text source
+func (v *validator) addLine(code Code, path string, line int, format string, args ...interface{}) {
+    v.add(code, path, format, args...)
+    v.problems[len(v.problems)-1].Line = line
+    v.problems[len(v.problems)-1].Column = 1
+}
+
+// merge adds the problems of err, leaving out any for a path that already has
+// a problem so a value that could not be read is not reported twice
+func (v *validator) merge(err error) {
+    verr, ok := err.(*ValidationError)
+    if !ok {
+        return
+    }
+
+    paths := map[string]bool{}
+    for _, p := range v.problems {
+        if p.Path != "" {
+            paths[p.Path] = true
+        }
+    }
+    for _, p := range verr.Problems {
+        if !paths[p.Path] {
+            v.problems = append(v.problems, p)
+        }
+    }
+}
+
+// err gives the problems as a ValidationError, or nil when there are none
+func (v *validator) err() error {
+    if len(v.problems) == 0 {
+        return nil
+    }
+    return &ValidationError{Problems: v.problems}
+}
+
+// locate sets the line and column of every problem from the JSON source. A
+// problem with a path that is not in the source, such as a missing field, is
+// placed at the closest value that contains it.
+func (v *validator) locate(data []byte) {
+    offsets := jsonOffsets(data)
+    for i := range v.problems {
+        p := &v.problems[i]
+        if p.Line > 0 {
+            continue
+        }
+
+        path := p.Path
+        for {
+            if offset, ok := offsets[path]; ok {
+                p.Line, p.Column = lineColumn(data, offset)
+                break
+            }
+            if path == "" {
+                break
+            }
+            path = parentPath(path)
+        }
+    }
+}
+
+// decodeProblem turns an error decoding JSON into a problem. A syntax error
+// is placed in the source by its offset and a type error by its path.
+func decodeProblem(data []byte, err error) Problem {
+    p := Problem{Code: CodeSyntax, Message: err.Error()}
+    switch err := err.(type) {
+    case *json.SyntaxError:
+        p.Line, p.Column = lineColumn(data, err.Offset)
+    case *json.UnmarshalTypeError:
+        p.Code = CodeType
+        p.Path = jsonPath(err.Field)
+        p.Message = fmt.Sprintf("Value should be %s, not %s", err.Type, err.Value)
+    }
+    return p
+}
+
+// jsonOffsets gives the offset in data of every value, keyed by JSON path.
+// Object members are placed at their key.
+func jsonOffsets(data []byte) map[string]int64 {
+    offsets := map[string]int64{}
+    dec := json.NewDecoder(bytes.NewReader(data))
+    walkJSON(dec, data, "", offsets)
+    return offsets
+}
+
+func walkJSON(dec *json.Decoder, data []byte, path string, offsets map[string]int64) error {
+    offsets[path] = skipSpace(data, dec.InputOffset())
+    tok, err := dec.Token()
+    if err != nil {
+        return err
+    }
+
+    switch tok {
+    case json.Delim('{'):
+        for dec.More() {
+            at := skipSpace(data, dec.InputOffset())
+            key, err := dec.Token()
+            if err != nil {
+                return err
+            }
+            member := fmt.Sprintf("%s.%s", path, key)
+            if path == "" {
+                member = fmt.Sprint(key)
+            }
+            err = walkJSON(dec, data, member, offsets)
+            if err != nil {
+                return err
+            }
+            offsets[member] = at
+        }
+        _, err = dec.Token()
+    case json.Delim('['):
+        for i := 0; dec.More(); i++ {
+            err = walkJSON(dec, data, fmt.Sprintf("%s[%d]", path, i), offsets)
+            if err != nil {
+                return err
+            }
+        }
+        _, err = dec.Token()
+    }
+    return err
+}
+
+// skipSpace moves past the whitespace and separators before a token
+func skipSpace(data []byte, offset int64) int64 {
+    for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+        offset++
+    }
+    return offset
+}
+
+// lineColumn gives the line and column of an offset in data
+func lineColumn(data []byte, offset int64) (int, int) {
+    if offset > int64(len(data)) {
+        offset = int64(len(data))
+    }
+    before := data[:offset]
+    line := bytes.Count(before, []byte("\n")) + 1
+    column := int(offset) - bytes.LastIndexByte(before, '\n')
+    return line, column
+}
+
+// parentPath gives the path of the value containing path
+func parentPath(path string) string {
+    i := strings.LastIndexAny(path, ".[")
+    if i < 0 {
+        return ""
+    }
+    return path[:i]
+}
+
+// jsonPath turns the dotted field of a decoding error, such as beats.3.tick,
+// into a JSON path such as beats[3].tick
+func jsonPath(field string) string {
+    path := ""
+    for _, part := range strings.Split(field, ".") {
+        if _, err := strconv.Atoi(part); err == nil {
+            path = fmt.Sprintf("%s[%s]", path, part)
+        } else if path == "" {
+            path = part
+        } else {
+            path = fmt.Sprintf("%s.%s", path, part)
+        }
+    }
+    return path
+}
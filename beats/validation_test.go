@@ -0,0 +1,114 @@
+package beats_test
+
+import (
+    "log"
+    "os"
+    "strings"
+    "testing"
+
+    "github.com/cody-s-lee/beats/beats"
+    "github.com/google/go-cmp/cmp"
+)
+
+// TestParseProblems verifies that every problem with a song file is reported
+// at once with its path, place in the file and code
+func TestParseProblems(t *testing.T) {
+    reader, err := os.Open("testdata/problems.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    _, err = beats.Parse(reader)
+    verr, ok := err.(*beats.ValidationError)
+    if !ok {
+        t.Fatalf("Expected a validation error but got %v", err)
+    }
+
+    expected := []beats.Problem{
+        beats.Problem{Code: beats.CodeName, Path: "name", Line: 2, Column: 5},
+        beats.Problem{Code: beats.CodeTempo, Path: "tempo", Line: 3, Column: 5},
+        beats.Problem{Code: beats.CodeTick, Path: "beats[1].tick", Line: 7, Column: 11},
+        beats.Problem{Code: beats.CodeTickRepeat, Path: "beats[2].tick", Line: 8, Column: 11},
+        beats.Problem{Code: beats.CodeLengthShort, Path: "length", Line: 4, Column: 5},
+    }
+    ignoreMessage := cmp.FilterPath(func(p cmp.Path) bool {
+        return p.Last().String() == ".Message"
+    }, cmp.Ignore())
+    if diff := cmp.Diff(expected, verr.Problems, ignoreMessage); diff != "" {
+        t.Errorf("Problems mismatch (-want +got):\n%s", diff)
+    }
+}
+
+// TestParseTypeProblem verifies that a value of the wrong type is reported
+// along with the problems found with the rest of the song
+func TestParseTypeProblem(t *testing.T) {
+    reader, err := os.Open("testdata/no-name.json")
+    if err != nil {
+        log.Fatal(err)
+    }
+    _, err = beats.Parse(reader)
+    if _, ok := err.(*beats.ValidationError); !ok {
+        t.Fatalf("Expected a validation error but got %v", err)
+    }
+
+    _, err = beats.Parse(strings.NewReader(`{"tempo": "fast", "beats": [{"tick": 1}]}`))
+    verr, ok := err.(*beats.ValidationError)
+    if !ok {
+        t.Fatalf("Expected a validation error but got %v", err)
+    }
+
+    var codes []beats.Code
+    for _, p := range verr.Problems {
+        codes = append(codes, p.Code)
+    }
+    expected := []beats.Code{beats.CodeType, beats.CodeName}
+    if diff := cmp.Diff(expected, codes); diff != "" {
+        t.Errorf("Codes mismatch (-want +got):\n%s", diff)
+    }
+}
+
+// TestNewSongProblems verifies that creating a song reports every problem
+func TestNewSongProblems(t *testing.T) {
+    _, err := beats.NewSong("", 120, []beats.Beat{
+        beats.Beat{Tick: 2, BassDrum: 1},
+        beats.Beat{Tick: -1, SnareDrum: 1},
+        beats.Beat{Tick: 2, HiHat: 1},
+    })
+    verr, ok := err.(*beats.ValidationError)
+    if !ok {
+        t.Fatalf("Expected a validation error but got %v", err)
+    }
+
+    var paths []string
+    for _, p := range verr.Problems {
+        paths = append(paths, p.Path)
+    }
+    expected := []string{"name", "beats[1].tick", "beats[2].tick"}
+    if diff := cmp.Diff(expected, paths); diff != "" {
+        t.Errorf("Paths mismatch (-want +got):\n%s", diff)
+    }
+}
+
+// TestParseGridProblems verifies that every problem with a grid is reported
+// with its line
+func TestParseGridProblems(t *testing.T) {
+    reader, err := os.Open("testdata/problems.grid")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    _, err = beats.ParseGrid(reader)
+    verr, ok := err.(*beats.ValidationError)
+    if !ok {
+        t.Fatalf("Expected a validation error but got %v", err)
+    }
+
+    var lines []int
+    for _, p := range verr.Problems {
+        lines = append(lines, p.Line)
+    }
+    expected := []int{2, 4, 5, 7}
+    if diff := cmp.Diff(expected, lines); diff != "" {
+        t.Errorf("Lines mismatch (-want +got):\n%s", diff)
+    }
+}
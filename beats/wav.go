@@ -0,0 +1,257 @@
+package beats
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "math"
+)
+
+// writeWAV writes mono samples in the range [-1, 1] to w as a 16-bit PCM WAV
+// file. Samples outside of the range are clipped.
+func writeWAV(w io.Writer, sampleRate int, samples []float64) error {
+    dataSize := uint32(len(samples) * 2)
+
+    header := struct {
+        ChunkID       [4]byte
+        ChunkSize     uint32
+        Format        [4]byte
+        Subchunk1ID   [4]byte
+        Subchunk1Size uint32
+        AudioFormat   uint16
+        NumChannels   uint16
+        SampleRate    uint32
+        ByteRate      uint32
+        BlockAlign    uint16
+        BitsPerSample uint16
+        Subchunk2ID   [4]byte
+        Subchunk2Size uint32
+    }{
+        ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
+        ChunkSize:     36 + dataSize,
+        Format:        [4]byte{'W', 'A', 'V', 'E'},
+        Subchunk1ID:   [4]byte{'f', 'm', 't', ' '},
+        Subchunk1Size: 16,
+        AudioFormat:   1,
+        NumChannels:   1,
+        SampleRate:    uint32(sampleRate),
+        ByteRate:      uint32(sampleRate * 2),
+        BlockAlign:    2,
+        BitsPerSample: 16,
+        Subchunk2ID:   [4]byte{'d', 'a', 't', 'a'},
+        Subchunk2Size: dataSize,
+    }
+
+    err := binary.Write(w, binary.LittleEndian, header)
+    if err != nil {
+        return err
+    }
+
+    return WritePCM(w, samples)
+}
+
+// pcm16 converts samples in the range [-1, 1] to signed 16-bit values
+func pcm16(samples []float64) []int16 {
+    data := make([]int16, len(samples))
+    for i, s := range samples {
+        if s > 1 {
+            s = 1
+        } else if s < -1 {
+            s = -1
+        }
+        data[i] = int16(math.Round(s * math.MaxInt16))
+    }
+    return data
+}
+
+// WritePCM writes samples in the range [-1, 1] to w as raw signed 16-bit
+// little-endian PCM with no header, suitable for streaming to an audio device.
+func WritePCM(w io.Writer, samples []float64) error {
+    return binary.Write(w, binary.LittleEndian, pcm16(samples))
+}
+
+// readWAV reads a PCM or IEEE float WAV file. Multiple channels are mixed down
+// to mono. The samples are returned in the range [-1, 1] along with the
+// sample rate of the file.
+func readWAV(r io.Reader) ([]float64, int, error) {
+    var riff struct {
+        ChunkID   [4]byte
+        ChunkSize uint32
+        Format    [4]byte
+    }
+    err := binary.Read(r, binary.LittleEndian, &riff)
+    if err != nil {
+        return nil, 0, err
+    }
+    if string(riff.ChunkID[:]) != "RIFF" || string(riff.Format[:]) != "WAVE" {
+        return nil, 0, errors.New("Not a WAV file")
+    }
+
+    var format struct {
+        AudioFormat   uint16
+        NumChannels   uint16
+        SampleRate    uint32
+        ByteRate      uint32
+        BlockAlign    uint16
+        BitsPerSample uint16
+    }
+    haveFormat := false
+
+    for {
+        var chunk struct {
+            ID   [4]byte
+            Size uint32
+        }
+        err = binary.Read(r, binary.LittleEndian, &chunk)
+        if err == io.EOF {
+            return nil, 0, errors.New("WAV file has no data")
+        }
+        if err != nil {
+            return nil, 0, err
+        }
+
+        switch string(chunk.ID[:]) {
+        case "fmt ":
+            body, err := readChunk(r, chunk.Size)
+            if err != nil {
+                return nil, 0, err
+            }
+            if len(body) < 16 {
+                return nil, 0, errors.New("WAV format chunk is too short")
+            }
+            err = binary.Read(bytes.NewReader(body), binary.LittleEndian, &format)
+            if err != nil {
+                return nil, 0, err
+            }
+            // WAVE_FORMAT_EXTENSIBLE keeps the real format in its sub-format
+            if format.AudioFormat == 0xFFFE && len(body) >= 26 {
+                format.AudioFormat = binary.LittleEndian.Uint16(body[24:26])
+            }
+            if format.NumChannels < 1 {
+                return nil, 0, errors.New("WAV file should have at least 1 channel")
+            }
+            if format.SampleRate == 0 {
+                return nil, 0, errors.New("WAV sample rate should be greater than 0")
+            }
+            _, err = sampleDecoder(int(format.AudioFormat), int(format.BitsPerSample))
+            if err != nil {
+                return nil, 0, err
+            }
+            haveFormat = true
+        case "data":
+            if !haveFormat {
+                return nil, 0, errors.New("WAV data chunk comes before format chunk")
+            }
+            body, err := readChunk(r, chunk.Size)
+            if err != nil {
+                return nil, 0, err
+            }
+            samples, err := decodeSamples(body, int(format.AudioFormat), int(format.NumChannels), int(format.BitsPerSample))
+            if err != nil {
+                return nil, 0, err
+            }
+            return samples, int(format.SampleRate), nil
+        default:
+            // Other chunks are skipped without being held in memory
+            _, err = io.CopyN(ioutil.Discard, r, int64(chunk.Size))
+            if err != nil {
+                return nil, 0, err
+            }
+        }
+        // Chunks are padded to an even size
+        if chunk.Size%2 == 1 {
+            io.ReadFull(r, make([]byte, 1))
+        }
+    }
+}
+
+// decodeSamples decodes interleaved sample frames into mono samples
+func decodeSamples(data []byte, audioFormat, channels, bits int) ([]float64, error) {
+    if channels < 1 {
+        return nil, errors.New("WAV file should have at least 1 channel")
+    }
+
+    decode, err := sampleDecoder(audioFormat, bits)
+    if err != nil {
+        return nil, err
+    }
+
+    width := bits / 8
+    frame := width * channels
+    samples := make([]float64, len(data)/frame)
+    for i := range samples {
+        s := 0.0
+        for c := 0; c < channels; c++ {
+            offset := i*frame + c*width
+            s += decode(data[offset : offset+width])
+        }
+        samples[i] = s / float64(channels)
+    }
+    return samples, nil
+}
+
+// sampleDecoder gives the function decoding one sample of a WAV format with
+// the given bits per sample
+func sampleDecoder(audioFormat, bits int) (func(b []byte) float64, error) {
+    switch {
+    case audioFormat == 1 && bits == 8:
+        return func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }, nil
+    case audioFormat == 1 && bits == 16:
+        return func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }, nil
+    case audioFormat == 1 && bits == 24:
+        return func(b []byte) float64 {
+            v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+            return float64(v) / (1 << 23)
+        }, nil
+    case audioFormat == 1 && bits == 32:
+        return func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }, nil
+    case audioFormat == 3 && bits == 32:
+        return func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }, nil
+    case audioFormat == 3 && bits == 64:
+        return func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }, nil
+    default:
+        return nil, fmt.Errorf("Unsupported WAV format %d with %d bits per sample", audioFormat, bits)
+    }
+}
+
+// resample converts samples between sample rates using linear interpolation.
+// Samples without a sample rate give none.
+func resample(samples []float64, from, to int) []float64 {
+    if from <= 0 || to <= 0 {
+        return nil
+    }
+    if from == to || len(samples) == 0 {
+        return samples
+    }
+
+    n := int(float64(len(samples)) * float64(to) / float64(from))
+    out := make([]float64, n)
+    for i := range out {
+        pos := float64(i) * float64(from) / float64(to)
+        j := int(pos)
+        frac := pos - float64(j)
+        if j+1 < len(samples) {
+            out[i] = samples[j]*(1-frac) + samples[j+1]*frac
+        } else {
+            out[i] = samples[len(samples)-1]
+        }
+    }
+    return out
+}
+
+// readChunk reads the size bytes of the body of a chunk from r. The body grows
+// as the bytes arrive rather than being made at the size the chunk header
+// claims, so a corrupt size runs out of file instead of memory.
+func readChunk(r io.Reader, size uint32) ([]byte, error) {
+    body, err := ioutil.ReadAll(io.LimitReader(r, int64(size)))
+    if err != nil {
+        return nil, err
+    }
+    if len(body) < int(size) {
+        return nil, io.ErrUnexpectedEOF
+    }
+    return body, nil
+}
@@ -3,7 +3,7 @@ module github.com/cody-s-lee/beats
 go 1.14
 
 require (
-    github.com/benbjohnson/clock v1.0.0
+    github.com/benbjohnson/clock v1.3.5
     github.com/google/go-cmp v0.4.0
     github.com/mattn/go-runewidth v0.0.8 // indirect
     github.com/nsf/termbox-go v0.0.0-20200204031403-4d2b513ad8be
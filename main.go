@@ -1,10 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/cody-s-lee/beats/beats"
@@ -16,20 +26,29 @@ func main() {
 	// No arguments given: play default song and quit gracefully
 	if len(args) == 0 {
 		song := getDefaultSong()
-		play(song)
+		play(song, playOptions{})
 		os.Exit(0)
 	}
 
 	switch args[0] {
 	case "play":
+		fs := newFlagSet("play")
+		kit := fs.String("kit", "", "")
+		pcm := fs.String("pcm", "", "")
+		rate := fs.Int("rate", 44100, "")
+		loop := fs.Bool("loop", false, "")
+		repeat := fs.Int("repeat", 1, "")
+		length := fs.Int("length", 0, "")
+		rest := parseFlags(fs, args[1:])
+
 		// Not enough args for play, show help and quit
-		if len(args) < 2 {
+		if len(rest) < 1 {
 			showHelp()
 			os.Exit(1)
 		}
 
 		// Grab file
-		fn := args[1]
+		fn := rest[0]
 		reader, err := os.Open(fn)
 		if err != nil {
 			fmt.Printf("Could not open file %s\n", fn)
@@ -38,12 +57,21 @@ func main() {
 		}
 
 		// Play file
-		song := getSong(reader)
-		play(song)
+		song := getSong(reader, fn)
+		if *length != 0 {
+			song = withLength(song, *length)
+		}
+		play(song, playOptions{
+			kit:    getKit(*kit),
+			pcm:    *pcm,
+			rate:   *rate,
+			loop:   *loop,
+			repeat: *repeat,
+		})
 		os.Exit(0)
 
 	case "create":
-		song := beats.Song{Tempo: 100}
+		song := beats.Song{Tempo: 100, StepsPerBeat: 4, Signature: "4/4"}
 
 		if len(args) > 1 {
 			// Grab file
@@ -56,12 +84,223 @@ func main() {
 			}
 
 			// Load song from file
-			song = getSong(reader)
+			song = getSong(reader, fn)
 		}
 
 		create(song)
 		os.Exit(0)
 
+	case "render":
+		fs := newFlagSet("render")
+		out := fs.String("o", "", "")
+		kit := fs.String("kit", "", "")
+		rate := fs.Int("rate", 44100, "")
+		rest := parseFlags(fs, args[1:])
+
+		// Not enough args for render, show help and quit
+		if len(rest) < 1 {
+			showHelp()
+			os.Exit(1)
+		}
+
+		// Grab file
+		fn := rest[0]
+		reader, err := os.Open(fn)
+		if err != nil {
+			fmt.Printf("Could not open file %s\n", fn)
+			showHelp()
+			os.Exit(1)
+		}
+
+		// Render song to file
+		song := getSong(reader, fn)
+		if *out == "" {
+			*out = fmt.Sprintf("%s.wav", song.Name)
+		}
+		render(song, getKit(*kit), *out, *rate)
+		os.Exit(0)
+
+	case "export":
+		fs := newFlagSet("export")
+		format := fs.String("format", "midi", "")
+		out := fs.String("o", "", "")
+		rest := parseFlags(fs, args[1:])
+
+		// Not enough args for export, show help and quit
+		if len(rest) < 1 {
+			showHelp()
+			os.Exit(1)
+		}
+
+		// Grab file
+		fn := rest[0]
+		reader, err := os.Open(fn)
+		if err != nil {
+			fmt.Printf("Could not open file %s\n", fn)
+			showHelp()
+			os.Exit(1)
+		}
+
+		// Export song to file
+		song := getSong(reader, fn)
+		export(song, *format, *out)
+		os.Exit(0)
+
+	case "import":
+		fs := newFlagSet("import")
+		out := fs.String("o", "", "")
+		name := fs.String("name", "", "")
+		accent := fs.Int("accent", beats.DefaultAccentVelocity, "")
+		steps := fs.Int("steps", beats.DefaultImportSteps, "")
+		rest := parseFlags(fs, args[1:])
+
+		// Not enough args for import, show help and quit
+		if len(rest) < 1 {
+			showHelp()
+			os.Exit(1)
+		}
+
+		// Grab file
+		fn := rest[0]
+		reader, err := os.Open(fn)
+		if err != nil {
+			fmt.Printf("Could not open file %s\n", fn)
+			showHelp()
+			os.Exit(1)
+		}
+
+		// Name the song after the file unless the file names it
+		if *name == "" {
+			*name = strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn))
+		}
+
+		// Import file as a song
+		importSMF(reader, beats.ImportOptions{
+			Name:           *name,
+			AccentVelocity: *accent,
+			StepsPerBeat:   *steps,
+		}, *out)
+		os.Exit(0)
+
+	case "validate":
+		fs := newFlagSet("validate")
+		strict := fs.Bool("strict", false, "")
+		rest := parseFlags(fs, args[1:])
+
+		// Not enough args for validate, show help and quit
+		if len(rest) < 1 {
+			showHelp()
+			os.Exit(1)
+		}
+
+		if !validate(rest, *strict) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "migrate":
+		// Not enough args for migrate, show help and quit
+		if len(args) < 2 {
+			showHelp()
+			os.Exit(1)
+		}
+
+		if !migrate(args[1:]) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	case "schema":
+		fs := newFlagSet("schema")
+		out := fs.String("o", "", "")
+		parseFlags(fs, args[1:])
+
+		schema(*out)
+		os.Exit(0)
+
+	case "gen":
+		// Not enough args for gen, show help and quit
+		if len(args) < 2 {
+			showHelp()
+			os.Exit(1)
+		}
+
+		switch args[1] {
+		case "euclid":
+			fs := newFlagSet("gen euclid")
+			inst := fs.String("inst", "", "")
+			hits := fs.Int("hits", 0, "")
+			steps := fs.Int("steps", 16, "")
+			rotate := fs.Int("rotate", 0, "")
+			pattern := fs.String("pattern", "", "")
+			out := fs.String("o", "", "")
+			rest := parseFlags(fs, args[2:])
+
+			// Without a song file the rhythm starts a new song
+			song := beats.Song{
+				Version:      beats.CurrentVersion,
+				Name:         fmt.Sprintf("Euclid %s %d-%d", *inst, *hits, *steps),
+				Tempo:        100,
+				StepsPerBeat: 4,
+				Signature:    "4/4",
+			}
+			if len(rest) > 0 {
+				// Grab file
+				fn := rest[0]
+				reader, err := os.Open(fn)
+				if err != nil {
+					fmt.Printf("Could not open file %s\n", fn)
+					showHelp()
+					os.Exit(1)
+				}
+
+				// The rhythm is written back to the song file
+				song = getSong(reader, fn)
+				if *out == "" {
+					*out = fn
+				}
+			}
+
+			euclid(song, euclidOptions{
+				inst:    *inst,
+				hits:    *hits,
+				steps:   *steps,
+				rotate:  *rotate,
+				pattern: *pattern,
+			}, *out)
+			os.Exit(0)
+
+		case "markov":
+			fs := newFlagSet("gen markov")
+			train := fs.String("train", "", "")
+			length := fs.Int("length", 64, "")
+			seed := fs.Int64("seed", 0, "")
+			name := fs.String("name", "Markov", "")
+			out := fs.String("o", "", "")
+			parseFlags(fs, args[2:])
+
+			// Not enough args for markov, show help and quit
+			if *train == "" {
+				showHelp()
+				os.Exit(1)
+			}
+
+			// Without a seed every run is new, and the seed is printed so it
+			// can be played again. Any seed given is kept, 0 included.
+			seeded := false
+			fs.Visit(func(f *flag.Flag) {
+				if f.Name == "seed" {
+					seeded = true
+				}
+			})
+			if !seeded {
+				*seed = time.Now().UnixNano()
+			}
+
+			markov(*train, *name, *length, *seed, *out)
+			os.Exit(0)
+		}
+
 	case "help", "-h", "--help":
 		showHelp()
 		os.Exit(0)
@@ -79,6 +318,14 @@ func showHelp() {
 command is one of:
     play <filename>        Play a song
     create [filename]      Create a song
+    render <filename>      Render a song to a WAV file
+    export <filename>      Export a song to another format
+    import <filename>      Import a song from a MIDI file
+    validate <filename>... Check song files and list every problem
+    schema                 Print the JSON Schema of the song format
+    migrate <filename>...  Upgrade song files in place to the current version
+    gen euclid [filename]  Write a Euclidean rhythm into an instrument of a song
+    gen markov             Generate a song in the style of a directory of songs
 
 
 If no command is given the default song (four on the floor) is played.
@@ -88,14 +335,47 @@ Play Mode:
 play takes a filename as an argument to load a song from a file. The song file should be a json representation of the song in the following format:
 
 {
+    "version": 2,
     "name": "song name",
     "tempo": 100,
+    "steps": 4,
+    "signature": "4/4",
+    "swing": 50,
+    "length": 16,
     "beats": [ <beat>... ]
 }
 
+- version is the version of the song format. Files without one are version 1 and are upgraded as they are read.
 - song name is required and must be non-empty
-- tempo is required and must be positive, denoted in beats per minute (bpm)
-- beats is an array of beat objects of the following format:
+- tempo is required and must be positive, denoted in beats per minute (bpm). It may be fractional such as 127.5.
+- tempos is optional, a tempo map of changes such as { "tick": 17, "bpm": 140, "ramp": "linear" }. From its tick the song plays at the new bpm. A linear ramp moves the tempo evenly from the change before; otherwise it jumps.
+- steps is optional, the number of ticks in each beat such as 4 for sixteenth notes or 3 for triplets. Without it each tick is a beat.
+- signature is optional, the time signature such as "3/4". Without it the song is in 4/4.
+- swing is optional, the percentage of each pair of ticks taken by the first, from 50 (straight) to 75 (hard shuffle). Every even tick is delayed by the difference. Without it the song plays straight.
+- length is optional, the number of ticks in the pattern. It must cover every beat. Without it the pattern ends on the last beat.
+- lanes is optional, a loop length in ticks for instruments that loop on their own such as { "hh": 3 }. The instrument repeats its first ticks from pass to pass against the pattern, and its notes must fit in its length.
+- beats is an array of beat objects of the following format, described below
+
+A song can instead be arranged from a bank of named patterns played in the order of its chain:
+
+{
+    "name": "song name",
+    "tempo": 100,
+    "patterns": [
+        { "name": "verse", "length": 16, "beats": [ <beat>... ] },
+        { "name": "fill", "length": 16, "beats": [ <beat>... ] }
+    ],
+    "chain": [
+        { "pattern": "verse", "repeat": 3 },
+        { "pattern": "fill" }
+    ]
+}
+
+- patterns is an array of patterns, each with a unique non-empty name, an optional length, optional lanes and its own beats numbered from 1
+- chain is an array of the patterns to play in order. repeat is optional, the number of times in a row the pattern plays, defaults to 1.
+- a song with a chain keeps all of its beats in patterns and has no beats or length of its own
+
+Beats have the following format:
 
 {
     "tick": 1,
@@ -123,47 +403,532 @@ play takes a filename as an argument to load a song from a file. The song file s
 -- hh: Hi-Hat              - off (0), closed (1), open (2)
 -- cy: Cymbal              - off (0), crash (1), ride (2)
 -- ac: Accent              - off (0), active (1)
+- Each instrument but the accent has a velocity field, its code followed by v such as sdv, from 1 to 127 for how hard it is struck. Without one a note plays at 96, or 127 on an accented tick.
+- Each instrument but the accent also has an articulation field, its code followed by a such as hha: 1 for a flam, with a soft grace note just ahead of the note, or 2 to 4 for a ratchet of that many hits across the tick.
+
+A song file with the .grid extension is read as a text grid instead, with a line of one character per tick for each instrument:
+
+name: song name
+tempo: 100
+steps: 4
+
+HH c.c.c.c.|c.c.c.c.
+SD ....1...|....1...
+BD x...x...|x...x...
+
+- name, tempo, tempos, steps, signature, swing and chain are "key: value" header lines. A chain is written as "verse x3, fill" and a tempo map as "49=120, 65=132 linear".
+- instrument lines start with CY, HH, HC, RC, HT, MT, LT, SD, BD or AC. Lines for silent instruments can be left out.
+- . or - is off and x is the first value of any instrument. The other values use the letters of create mode: c and r for the cymbal, c and o for the hi-hat, h and t for the hand clap/tambourine, r and c for the rimshot/cowbell, 1 and 2 for the snare and bass drums.
+- spaces and | between steps are ignored so bars can be marked
+- "<code> velocity: 5=40, 13=40" sets the velocity of an instrument on ticks 5 and 13
+- "<code> articulation: 5=flam, 13=x3" sets a flam on tick 5 and a ratchet of 3 hits on tick 13
+- "<code> length: 3" loops the instrument on its first 3 ticks, which its line gives
+- "pattern: <name>" starts a pattern whose instrument lines follow
+- blank lines and lines starting with # are ignored
+
+Options:
+    -loop              play the song over and over until quit
+    -repeat <n>        play the song n times, defaults to 1
+    -length <ticks>    length of the pattern in ticks, defaults to the song length; not for songs with a chain
+    -kit <filename>    kit manifest of samples to play, see Kits below
+    -pcm <filename>    also stream the song as raw 16-bit mono PCM to a file, or - for stdout
+    -rate <rate>       sample rate of the PCM stream in Hz, defaults to 44100
 
 Create Mode:
 
-create has a term-based ui for song creation. Optionally a filename of a song can be used to load in a song to work on.
+create has a term-based ui for song creation. Optionally a filename of a song, json or grid, can be used to load in a song to work on. The ui fills the width of the terminal, showing as many ticks as fit, and needs at least 48 columns by 24 rows.
 
 Commands:
     ctrl-s to save to <name>.json
     ctrl-q to quit
+    ctrl-z to undo the last edit and ctrl-y to redo it, up to 100 edits back
+    space to play the pattern being edited on a loop, or stop it, when not in input mode
+
+    shift and the arrow keys, or v and then the arrow keys, select a block of instruments and ticks when not in input mode
+    ctrl-c copies the selection, ctrl-x cuts it and ctrl-v pastes with its top left at the highlighted cell or the selection
+    d duplicates the selection onto the next bar and selects the copy
+    < and > shift the selection a tick left or right
+    delete or backspace clears the selection
+    any other key leaves the selection
+
+    a left click on the grid cycles the instrument through its values and a right click silences it
+    a click on the name, swing or tempo starts typing into it
+    the mouse wheel scrolls the grid a beat at a time
 
     enter to enter or leave input mode for highlighted cell
     arrow keys modify the current cell when in input mode
     arrow keys move around the board when not in input mode
+    - and + soften or strengthen the highlighted note in input mode, 0 resets it
+    a cycles the highlighted note through a flam and ratchets of 2 to 4 hits in input mode
+    l loops the highlighted instrument at the highlighted tick in input mode, or stops it looping there
+    e and E spread one more or one fewer hit of the highlighted instrument evenly over its lane in input mode, starting at the highlighted tick
+    page up and page down to edit the previous or next pattern
+    ctrl-n to add a new pattern to the end of the chain
+
+Render Mode:
+
+render synthesizes the song loaded from a file and writes it as a mono 16-bit WAV file.
+
+Options:
+    -o <filename>      output file, defaults to <name>.wav
+    -kit <filename>    kit manifest of samples to play, see Kits below
+    -rate <rate>       sample rate in Hz, defaults to 44100
+
+Export Mode:
+
+export writes the song loaded from a file in another format.
+
+Options:
+    --format <format>    format to export, defaults to midi
+    -o <filename>        output file, defaults to <name> with the extension of the format
+
+Formats:
+    midi    Type 0 Standard MIDI File on the General MIDI drum channel (10)
+    grid    text grid with a line of steps for each instrument, see Play Mode
+
+Import Mode:
+
+import reads a Type 0 or Type 1 Standard MIDI File and writes it as a song file. Drum notes on the General MIDI drum channel (10) are quantized to the nearest sixteenth note, or the step resolution set with -steps. Drum notes that have no matching instrument, or whose instrument is already playing on the tick, are reported and left out.
+
+Options:
+    -o <filename>        output file, defaults to <name>.json
+    -name <name>         song name when the file has no track name, defaults to the file name
+    -accent <velocity>   notes louder than this velocity accent their tick, defaults to 100
+    -steps <steps>       ticks per quarter note to quantize to, defaults to 4 for sixteenth notes
+
+Validate Mode:
+
+validate checks one or more song files, json or grid, and prints every problem found in each as <file>:<line>:<column>: <path>: <message> (<code>). The path is the JSON path of the value at fault, such as beats[3].tick, and the code is stable for matching in scripts. It exits with status 1 when any file has a problem.
+
+Options:
+    -strict            also reject json fields the song format does not have and instrument values out of range
+
+Migrate Mode:
+
+migrate rewrites one or more json song files in place as the current version of the song format. Files already at the current version are left alone, and files with problems under strict validation are reported and left alone. Older files are also upgraded as they are read by every other command, so migrating is only needed to keep a song library up to date.
+
+Gen Mode:
+
+gen euclid writes a Euclidean rhythm, hits spread as evenly as they go over a number of steps, into an instrument of the song loaded from a file and saves it back, or starts a new song without one. The rhythm replaces the notes of the instrument and keeps the other instruments. A rhythm shorter than the pattern loops on a lane of its own.
+
+Options:
+    -inst <code>       instrument to write the rhythm into, such as bd or hh
+    -hits <n>          number of hits
+    -steps <n>         number of steps the hits are spread over, defaults to 16
+    -rotate <n>        steps to move the hits later by, wrapping around
+    -pattern <name>    pattern to write the rhythm into, for songs with a chain
+    -o <filename>      output file, json or grid, defaults to the song file or <name>.json
+
+gen markov learns how the beats of every song file, json or grid, in a directory follow one another at each step of the bar and generates a new song from that. The song plays at the average tempo of the songs, in their most common meter. Files that do not parse are reported and left out.
+
+Options:
+    -train <dir>       directory of songs to learn from
+    -length <ticks>    length of the song in ticks, defaults to 64
+    -seed <n>          seed of the generator, so the same seed and songs give the same song; defaults to the time, which is printed
+    -name <name>       song name, defaults to Markov
+    -o <filename>      output file, json or grid, defaults to <name>.json
+
+Schema Mode:
+
+schema prints a JSON Schema of the json song format, generated from the song types, for editors and other tools to check song files against.
+
+Options:
+    -o <filename>      output file, defaults to stdout
+
+Kits:
+
+A kit manifest is a json file mapping notes to WAV samples. Sample paths are relative to the manifest. Notes without a sample use the synthesized voice.
+
+{
+    "name": "kit name",
+    "samples": {
+        "bass_1": "bd1.wav",
+        "hh_open": "hh-open.wav"
+    }
+}
+
+Notes are bass_1, bass_2, snare_1, snare_2, low_tom, mid_tom, hi_tom, rim, cow, hcp, tamb, hh_closed, hh_open, cy_crash and cy_ride.
 `, os.Args[0])
 }
 
+// newFlagSet creates the flag set for a command. Invalid flags show the help
+// and quit.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = showHelp
+	return fs
+}
+
+// parseFlags parses the flags for a command, allowing flags to come before or
+// after the positional arguments. The positional arguments are returned.
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return positional
+}
+
 func create(song beats.Song) {
 	beats.Create(song)
 }
 
-func play(song beats.Song) {
-	fmt.Printf("Name: %s\n", song.Name)
-	fmt.Printf("Tempo: %d bpm\n", song.Tempo)
+// playOptions are the options for the play command. When pcm is set the
+// mixed audio of each step is streamed to that file as it plays. Loop plays
+// the song until quit, otherwise it plays repeat times.
+type playOptions struct {
+	kit    *beats.Kit
+	pcm    string
+	rate   int
+	loop   bool
+	repeat int
+}
 
-	clock := clock.New()
-	out := make(chan beats.Step)
+func play(song beats.Song, opts playOptions) {
+	console := io.Writer(os.Stdout)
 
-	go song.Play(clock, out)
+	var pcm io.Writer
+	var mixer *beats.Mixer
+	if opts.pcm != "" {
+		if opts.pcm == "-" {
+			// Keep stdout clean for the audio stream
+			pcm = os.Stdout
+			console = os.Stderr
+		} else {
+			file, err := os.Create(opts.pcm)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer file.Close()
+			pcm = file
+		}
+		mixer = beats.NewMixer(opts.kit, opts.rate)
+	}
 
-	for s := range out {
-		fmt.Printf("%d: %s\n", s.Tick, s.Beat)
+	fmt.Fprintf(console, "Name: %s\n", song.Name)
+	fmt.Fprintf(console, "Tempo: %g bpm\n", song.Tempo)
+	if len(song.Tempos) > 0 {
+		fmt.Fprintf(console, "Tempo changes: %s\n", tempos(song))
+	}
+	fmt.Fprintf(console, "Time: %s, %d steps per beat\n", signature(song), song.Steps())
+	if len(song.Chain) > 0 {
+		fmt.Fprintf(console, "Chain: %s\n", chain(song))
+	}
+
+	// Ticks and positions count through the whole chain
+	song = song.Arrange()
+
+	playOpts := []beats.PlayOption{beats.WithRepeat(opts.repeat)}
+	if opts.loop {
+		playOpts = append(playOpts, beats.WithLoop())
+	}
+
+	player := beats.NewPlayer(song, clock.New(), playOpts...)
+
+	// Stop cleanly on interrupt so a looping song still flushes its audio
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		player.Stop()
+	}()
+
+	err := player.Start(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for s := range player.Steps() {
+		// The listing and the mixer take each tick whole, flams and ratchets
+		// included, with the mixer looking ahead to the grace notes of the
+		// next tick
+		if s.Sub != 0 {
+			continue
+		}
+		fmt.Fprintf(console, "%d (%s): %s\n", s.Tick, position(song, s.Tick), s.Beat)
+		if mixer != nil {
+			err := beats.WritePCM(pcm, mixer.Mix(s.Beat, s.Next, song.StepDuration(s.Tick)))
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	if mixer != nil {
+		err := beats.WritePCM(pcm, mixer.Flush())
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 }
 
-func getSong(reader io.Reader) beats.Song {
-	song, err := beats.Parse(reader)
+func render(song beats.Song, kit *beats.Kit, fn string, rate int) {
+	file, err := os.Create(fn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	err = song.RenderKit(file, rate, kit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Rendered %s to %s\n", song.Name, fn)
+}
+
+// signature gives the time signature of a song
+func signature(song beats.Song) string {
+	beats, unit := song.Meter()
+	return fmt.Sprintf("%d/%d", beats, unit)
+}
+
+// chain describes the order a song plays its patterns in, such as "A x2, B"
+func chain(song beats.Song) string {
+	var links []string
+	for _, link := range song.Chain {
+		links = append(links, link.String())
+	}
+	return strings.Join(links, ", ")
+}
+
+// tempos gives the tempo map of a song written as in a grid
+func tempos(song beats.Song) string {
+	var changes []string
+	for _, change := range song.Tempos {
+		changes = append(changes, change.String())
+	}
+	return strings.Join(changes, ", ")
+}
+
+// position gives the bar and beat of a tick, and the step within the beat
+// when there is more than one
+func position(song beats.Song, tick int) string {
+	bar, beat, step := song.Position(tick)
+	if song.Steps() == 1 {
+		return fmt.Sprintf("%d.%d", bar, beat)
+	}
+	return fmt.Sprintf("%d.%d.%d", bar, beat, step)
+}
+
+// withLength sets the pattern length of a song, quitting when it does not cover
+// every beat
+func withLength(song beats.Song, length int) beats.Song {
+	if len(song.Chain) > 0 {
+		fmt.Println("Length cannot be set for a song with a chain; set it on its patterns")
+		os.Exit(1)
+	}
+	if length < song.Ticks() {
+		fmt.Printf("Length %d is shorter than the song's %d ticks\n", length, song.Ticks())
+		os.Exit(1)
+	}
+	song.Length = length
+	return song
+}
+
+// migrate rewrites every json song file in fns in place as the current
+// version of the format. Files are checked strictly first and any with
+// problems are reported and left alone. The upgraded document is written as it
+// comes from the migrations so no member of the file is lost. It reports
+// whether every file could be migrated.
+func migrate(fns []string) bool {
+	ok := true
+	for _, fn := range fns {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			fmt.Printf("%s: Could not open file\n", fn)
+			ok = false
+			continue
+		}
+
+		upgraded, version, err := beats.Upgrade(data)
+		if err == nil && version == beats.CurrentVersion {
+			fmt.Printf("%s: Already version %d\n", fn, version)
+			continue
+		}
+
+		_, err = beats.ParseStrict(bytes.NewReader(data))
+		if err != nil {
+			printProblems(fn, err)
+			ok = false
+			continue
+		}
+
+		var b bytes.Buffer
+		err = json.Indent(&b, upgraded, "", "    ")
+		if err == nil {
+			b.WriteByte('\n')
+			err = ioutil.WriteFile(fn, b.Bytes(), 0644)
+		}
+		if err != nil {
+			fmt.Printf("%s: %v\n", fn, err)
+			ok = false
+			continue
+		}
+		fmt.Printf("%s: Migrated from version %d to %d\n", fn, version, beats.CurrentVersion)
+	}
+	return ok
+}
+
+// schema writes the JSON Schema of the song format to the file fn, or to
+// stdout when fn is empty
+func schema(fn string) {
+	w := io.Writer(os.Stdout)
+	if fn != "" {
+		file, err := os.Create(fn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	err := beats.WriteSchema(w)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parser gives the parser for the song file fn, for a text grid when the file
+// has the .grid extension and for json otherwise
+func parser(fn string) func(io.Reader) (*beats.Song, error) {
+	if strings.EqualFold(filepath.Ext(fn), ".grid") {
+		return beats.ParseGrid
+	}
+	return beats.Parse
+}
+
+// getSong parses the song read from the file fn
+func getSong(reader io.Reader, fn string) beats.Song {
+	song, err := parser(fn)(reader)
 	if err != nil {
 		log.Fatal(err)
 	}
 	return *song
 }
 
+func export(song beats.Song, format string, fn string) {
+	var write func(io.Writer) error
+	var ext string
+	switch format {
+	case "midi":
+		write = song.WriteSMF
+		ext = "mid"
+	case "grid":
+		write = song.WriteGrid
+		ext = "grid"
+	default:
+		fmt.Printf("Unknown export format %s\n", format)
+		showHelp()
+		os.Exit(1)
+	}
+
+	if fn == "" {
+		fn = fmt.Sprintf("%s.%s", song.Name, ext)
+	}
+
+	file, err := os.Create(fn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	err = write(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Exported %s to %s\n", song.Name, fn)
+}
+
+func importSMF(reader io.Reader, opts beats.ImportOptions, fn string) {
+	song, unmapped, err := beats.ReadSMF(reader, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, u := range unmapped {
+		fmt.Printf("Skipped %s\n", u)
+	}
+
+	if fn == "" {
+		fn = fmt.Sprintf("%s.json", song.Name)
+	}
+
+	file, err := os.Create(fn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	err = song.WriteJSON(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Imported %s to %s\n", song.Name, fn)
+}
+
+// validate checks every song file in fns and prints each problem found,
+// prefixed by the file name and position. Json files are parsed strictly when
+// strict is set. It reports whether every file is valid.
+func validate(fns []string, strict bool) bool {
+	valid := true
+	for _, fn := range fns {
+		reader, err := os.Open(fn)
+		if err != nil {
+			fmt.Printf("%s: Could not open file\n", fn)
+			valid = false
+			continue
+		}
+
+		parse := parser(fn)
+		if strict && !strings.EqualFold(filepath.Ext(fn), ".grid") {
+			parse = beats.ParseStrict
+		}
+		_, err = parse(reader)
+		reader.Close()
+		if err == nil {
+			continue
+		}
+		valid = false
+		printProblems(fn, err)
+	}
+	return valid
+}
+
+// printProblems prints every problem of an error parsing the song file fn,
+// prefixed by the file name and position
+func printProblems(fn string, err error) {
+	verr, ok := err.(*beats.ValidationError)
+	if !ok {
+		fmt.Printf("%s: %v\n", fn, err)
+		return
+	}
+	for _, p := range verr.Problems {
+		if p.Line > 0 {
+			fmt.Printf("%s:%s\n", fn, p)
+		} else {
+			fmt.Printf("%s: %s\n", fn, p)
+		}
+	}
+}
+
+// getKit loads the kit manifest in fn. No kit is loaded for an empty filename.
+func getKit(fn string) *beats.Kit {
+	if fn == "" {
+		return nil
+	}
+	kit, err := beats.LoadKit(fn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return kit
+}
+
 func getDefaultSong() beats.Song {
 	song, err := beats.Default()
 	if err != nil {
@@ -171,3 +936,107 @@ func getDefaultSong() beats.Song {
 	}
 	return *song
 }
+
+// euclidOptions are the options for the gen euclid command: the rhythm, the
+// instrument it is written into and the pattern of a song with a chain that
+// holds it
+type euclidOptions struct {
+	inst    string
+	hits    int
+	steps   int
+	rotate  int
+	pattern string
+}
+
+// euclid writes a Euclidean rhythm into an instrument of a song, merging it
+// with the other instruments, and saves the song to the file fn or to
+// <name>.json when fn is empty
+func euclid(song beats.Song, opts euclidOptions, fn string) {
+	rhythm, err := beats.Euclid(opts.hits, opts.steps, opts.rotate)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.pattern == "" {
+		err = song.SetLane(opts.inst, rhythm)
+	} else {
+		err = fmt.Errorf("Unknown pattern %s", opts.pattern)
+		for i := range song.Patterns {
+			if song.Patterns[i].Name == opts.pattern {
+				err = song.Patterns[i].SetLane(opts.inst, rhythm)
+			}
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if fn == "" {
+		fn = fmt.Sprintf("%s.json", song.Name)
+	}
+	save(song, fn)
+	fmt.Printf("Wrote %d hits over %d steps on %s to %s\n", opts.hits, opts.steps, opts.inst, fn)
+}
+
+// save writes a song to the file fn, as a text grid when the file has the
+// .grid extension and as json otherwise
+func save(song beats.Song, fn string) {
+	write := song.WriteJSON
+	if strings.EqualFold(filepath.Ext(fn), ".grid") {
+		write = song.WriteGrid
+	}
+
+	file, err := os.Create(fn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	err = write(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// markov generates a song of length ticks in the style of the songs in the
+// directory dir and saves it to the file fn or to <name>.json when fn is
+// empty
+func markov(dir string, name string, length int, seed int64, fn string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	model := beats.NewMarkov()
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if file.IsDir() || ext != ".json" && ext != ".grid" {
+			continue
+		}
+
+		fn := filepath.Join(dir, file.Name())
+		reader, err := os.Open(fn)
+		if err != nil {
+			fmt.Printf("%s: Could not open file\n", fn)
+			continue
+		}
+		song, err := parser(fn)(reader)
+		reader.Close()
+		if err != nil {
+			printProblems(fn, err)
+			continue
+		}
+		model.Train(*song)
+	}
+
+	song, err := model.Generate(name, length, rand.New(rand.NewSource(seed)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if fn == "" {
+		fn = fmt.Sprintf("%s.json", song.Name)
+	}
+	save(*song, fn)
+	fmt.Printf("Generated %s with seed %d to %s\n", song.Name, seed, fn)
+}